@@ -0,0 +1,330 @@
+// Package decimal is a fixed-point decimal type for prices. A Decimal is
+// an int64 count of units at a given scale, so 145.30 is 14530 units at
+// scale 2. Each instrument picks its scale; arithmetic between values of
+// different scales works at the larger of the two.
+//
+// Values are expected to fit in an int64 at their scale; operations don't
+// check for overflow.
+package decimal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MaxScale is the largest supported scale. 10^18 is the largest power of
+// ten that fits in an int64.
+const MaxScale = 18
+
+// maxExponent bounds the exponent Parse accepts, far beyond what any
+// representable value needs, so the scale arithmetic can't overflow.
+const maxExponent = 1000
+
+var pow10 = func() [MaxScale + 1]int64 {
+	var p [MaxScale + 1]int64
+	p[0] = 1
+	for i := 1; i <= MaxScale; i++ {
+		p[i] = p[i-1] * 10
+	}
+	return p
+}()
+
+var ErrSyntax = errors.New("decimal: invalid syntax")
+var ErrRange = errors.New("decimal: value out of range")
+var ErrDivisionByZero = errors.New("decimal: division by zero")
+
+// Decimal is units / 10^scale. The zero value is 0.
+type Decimal struct {
+	units int64
+	scale uint8
+}
+
+// New returns units / 10^scale. Scales outside [0, MaxScale] are clamped.
+func New(units int64, scale int) Decimal {
+	return Decimal{units: units, scale: uint8(clampScale(scale))}
+}
+
+// maxUnits is 2^63 as a float64, the first value too large for units.
+const maxUnits = 1 << 63
+
+// FromFloat returns the shortest decimal that round-trips to f, so
+// FromFloat(145.3) is exactly 145.3. When that has more digits than an
+// int64 holds, f is rounded to as many decimal places as fit. NaN,
+// infinities and magnitudes of 2^63 or more return ErrRange.
+func FromFloat(f float64) (Decimal, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) >= maxUnits {
+		return Decimal{}, fmt.Errorf("%w: %v", ErrRange, f)
+	}
+	d, err := Parse(strconv.FormatFloat(f, 'f', -1, 64))
+	if err == nil {
+		return d, nil
+	}
+	scale := MaxScale
+	for scale > 0 && math.Abs(f)*float64(pow10[scale]) >= maxUnits {
+		scale--
+	}
+	return FromFloatScale(f, scale), nil
+}
+
+// FromFloatScale rounds f to scale decimal places, half away from zero.
+// Values that don't fit saturate at the int64 limits, and NaN is zero.
+func FromFloatScale(f float64, scale int) Decimal {
+	scale = clampScale(scale)
+	v := math.Round(f * float64(pow10[scale]))
+	var units int64
+	switch {
+	case v >= maxUnits:
+		units = math.MaxInt64
+	case v < -maxUnits:
+		units = math.MinInt64
+	case !math.IsNaN(v):
+		units = int64(v)
+	}
+	return Decimal{units: units, scale: uint8(scale)}
+}
+
+// Parse reads a plain decimal such as "-145.30" or "1.5e-3". The scale of
+// the result is the number of digits after the point.
+func Parse(s string) (Decimal, error) {
+	orig := s
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return Decimal{}, fmt.Errorf("%w: %q", ErrSyntax, orig)
+		}
+		if e < -maxExponent || e > maxExponent {
+			return Decimal{}, fmt.Errorf("%w: %q", ErrRange, orig)
+		}
+		exp, s = e, s[:i]
+	}
+
+	neg := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		neg, s = s[0] == '-', s[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrSyntax, orig)
+	}
+
+	var units uint64
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return Decimal{}, fmt.Errorf("%w: %q", ErrSyntax, orig)
+		}
+		digit := uint64(c - '0')
+		if units > (math.MaxInt64-digit)/10 {
+			return Decimal{}, fmt.Errorf("%w: %q", ErrRange, orig)
+		}
+		units = units*10 + digit
+	}
+
+	scale := len(fracPart) - exp
+	if units == 0 {
+		scale = max(scale, 0) // zero needs no digits before the point
+	}
+	for scale < 0 {
+		if units > math.MaxInt64/10 {
+			return Decimal{}, fmt.Errorf("%w: %q", ErrRange, orig)
+		}
+		units *= 10
+		scale++
+	}
+	if scale > MaxScale {
+		return Decimal{}, fmt.Errorf("%w: %q has more than %d decimal places", ErrRange, orig, MaxScale)
+	}
+
+	d := Decimal{units: int64(units), scale: uint8(scale)}
+	if neg {
+		d.units = -d.units
+	}
+	return d, nil
+}
+
+// MustParse is Parse for constants; it panics on error.
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (d Decimal) Units() int64 { return d.units }
+func (d Decimal) Scale() int   { return int(d.scale) }
+
+func (d Decimal) Float64() float64 {
+	return float64(d.units) / float64(pow10[d.scale])
+}
+
+func (d Decimal) Sign() int {
+	switch {
+	case d.units < 0:
+		return -1
+	case d.units > 0:
+		return 1
+	}
+	return 0
+}
+
+func (d Decimal) IsZero() bool { return d.units == 0 }
+
+func (d Decimal) Neg() Decimal { return Decimal{units: -d.units, scale: d.scale} }
+
+func (d Decimal) Abs() Decimal {
+	if d.units < 0 {
+		return d.Neg()
+	}
+	return d
+}
+
+// Rescale returns d at the given scale, rounding half away from zero when
+// digits are dropped.
+func (d Decimal) Rescale(scale int) Decimal {
+	scale = clampScale(scale)
+	switch {
+	case scale == int(d.scale):
+		return d
+	case scale > int(d.scale):
+		return Decimal{units: d.units * pow10[scale-int(d.scale)], scale: uint8(scale)}
+	}
+	div := pow10[int(d.scale)-scale]
+	q, r := d.units/div, d.units%div
+	if r >= div-r && r > 0 {
+		q++
+	} else if r < 0 && -r >= div+r {
+		q--
+	}
+	return Decimal{units: q, scale: uint8(scale)}
+}
+
+// align returns both values at the larger of their scales.
+func align(a, b Decimal) (int64, int64, uint8) {
+	if a.scale == b.scale {
+		return a.units, b.units, a.scale
+	}
+	if a.scale > b.scale {
+		return a.units, b.Rescale(int(a.scale)).units, a.scale
+	}
+	return a.Rescale(int(b.scale)).units, b.units, b.scale
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	a, b, scale := align(d, o)
+	return Decimal{units: a + b, scale: scale}
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	a, b, scale := align(d, o)
+	return Decimal{units: a - b, scale: scale}
+}
+
+// Cmp returns -1, 0 or +1 as d is less than, equal to or greater than o.
+// Scale doesn't matter: 1.5 and 1.50 compare equal.
+func (d Decimal) Cmp(o Decimal) int {
+	a, b, _ := align(d, o)
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Equal reports whether d and o have the same value, whatever their scale.
+func (d Decimal) Equal(o Decimal) bool { return d.Cmp(o) == 0 }
+
+// Mul returns d*o rounded half away from zero to scale.
+func (d Decimal) Mul(o Decimal, scale int) Decimal {
+	num := new(big.Int).Mul(big.NewInt(d.units), big.NewInt(o.units))
+	return fromRat(num, big.NewInt(pow10[d.scale]), int(o.scale), scale)
+}
+
+// Div returns d/o rounded half away from zero to scale.
+func (d Decimal) Div(o Decimal, scale int) (Decimal, error) {
+	if o.units == 0 {
+		return Decimal{}, ErrDivisionByZero
+	}
+	// d/o = (d.units * 10^o.scale) / (o.units * 10^d.scale)
+	num := new(big.Int).Mul(big.NewInt(d.units), big.NewInt(pow10[o.scale]))
+	den := new(big.Int).Mul(big.NewInt(o.units), big.NewInt(pow10[d.scale]))
+	return fromRat(num, den, 0, scale), nil
+}
+
+// fromRat rounds num / (den * 10^extra) to scale.
+func fromRat(num, den *big.Int, extra, scale int) Decimal {
+	scale = clampScale(scale)
+	num = new(big.Int).Mul(num, big.NewInt(pow10[scale]))
+	den = new(big.Int).Mul(den, big.NewInt(pow10[extra]))
+	if den.Sign() < 0 {
+		num.Neg(num)
+		den.Neg(den)
+	}
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	// round half away from zero: compare 2|r| with den
+	r.Abs(r).Lsh(r, 1)
+	if r.Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Decimal{units: q.Int64(), scale: uint8(scale)}
+}
+
+// String formats d with exactly Scale digits after the point.
+func (d Decimal) String() string {
+	return string(d.AppendText(nil))
+}
+
+func (d Decimal) AppendText(buf []byte) []byte {
+	u := uint64(d.units)
+	if d.units < 0 {
+		buf = append(buf, '-')
+		u = -u
+	}
+	digits := strconv.AppendUint(nil, u, 10)
+	scale := int(d.scale)
+	if scale == 0 {
+		return append(buf, digits...)
+	}
+	for len(digits) <= scale {
+		digits = append([]byte{'0'}, digits...)
+	}
+	split := len(digits) - scale
+	buf = append(buf, digits[:split]...)
+	buf = append(buf, '.')
+	return append(buf, digits[split:]...)
+}
+
+// MarshalJSON writes d as a JSON number with its exact digits, so 145.30
+// is sent as 145.30 and never as a rounded float.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return d.AppendText(nil), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string holding one.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+func clampScale(scale int) int {
+	return min(max(scale, 0), MaxScale)
+}
@@ -0,0 +1,206 @@
+package decimal
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRescale(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		scale int
+		want  string
+	}{
+		{"1.25", 1, "1.3"},
+		{"1.24", 1, "1.2"},
+		{"-1.25", 1, "-1.3"},
+		{"-1.24", 1, "-1.2"},
+		{"-1.26", 1, "-1.3"},
+		{"0.5", 0, "1"},
+		{"-0.5", 0, "-1"},
+		{"-0.49", 0, "0"},
+		{"-145.3", 3, "-145.300"},
+		{"1.5", 30, "1.500000000000000000"},
+		{"1.5", -1, "2"},
+	} {
+		if got := MustParse(tc.in).Rescale(tc.scale).String(); got != tc.want {
+			t.Errorf("%s.Rescale(%d) = %s, want %s", tc.in, tc.scale, got, tc.want)
+		}
+	}
+}
+
+func TestMulDivRounding(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		got  func() (Decimal, error)
+		want string
+	}{
+		{"1/8", func() (Decimal, error) { return New(1, 0).Div(New(8, 0), 2) }, "0.13"},
+		{"-1/8", func() (Decimal, error) { return New(-1, 0).Div(New(8, 0), 2) }, "-0.13"},
+		{"1/-8", func() (Decimal, error) { return New(1, 0).Div(New(-8, 0), 2) }, "-0.13"},
+		{"-1/3", func() (Decimal, error) { return New(-1, 0).Div(New(3, 0), 4) }, "-0.3333"},
+		{"-0.05*0.5", func() (Decimal, error) { return MustParse("-0.05").Mul(MustParse("0.5"), 2), nil }, "-0.03"},
+		{"-0.05*-0.5", func() (Decimal, error) { return MustParse("-0.05").Mul(MustParse("-0.5"), 2), nil }, "0.03"},
+		{"1.10*1.10", func() (Decimal, error) { return MustParse("1.10").Mul(MustParse("1.10"), 4), nil }, "1.2100"},
+	} {
+		got, err := tc.got()
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got.String() != tc.want {
+			t.Errorf("%s = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+	if _, err := New(1, 0).Div(Decimal{}, 2); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("division by zero: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		want  string
+		scale int
+	}{
+		{"145.30", "145.30", 2},
+		{"-145.30", "-145.30", 2},
+		{"+.5", "0.5", 1},
+		{"5.", "5", 0},
+		{"1.5e-3", "0.0015", 4},
+		{"1.5E2", "150", 0},
+		{"-2e0", "-2", 0},
+		{"9223372036854775807", "9223372036854775807", 0},
+		{"0.000000000000000001", "0.000000000000000001", 18},
+		{"0e1000", "0", 0},
+		{"-0.00e5", "0", 0},
+		{"0.0e-3", "0.0000", 4},
+		{"12e-1", "1.2", 1},
+		{"0." + strings.Repeat("0", 79) + "1e80", "1", 0},
+	} {
+		d, err := Parse(tc.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.in, err)
+			continue
+		}
+		if d.String() != tc.want || d.Scale() != tc.scale {
+			t.Errorf("Parse(%q) = %s at scale %d, want %s at scale %d", tc.in, d, d.Scale(), tc.want, tc.scale)
+		}
+	}
+
+	for _, tc := range []struct {
+		in   string
+		want error
+	}{
+		{"", ErrSyntax},
+		{"-", ErrSyntax},
+		{".", ErrSyntax},
+		{"1e", ErrSyntax},
+		{"abc", ErrSyntax},
+		{"1.2.3", ErrSyntax},
+		{"1,5", ErrSyntax},
+		{"9223372036854775808", ErrRange},
+		{"1e19", ErrRange},
+		{"1e-19", ErrRange},
+		{"0.0000000000000000001", ErrRange},
+		{"0e99999999999", ErrRange},
+		{"0e-99999999999", ErrRange},
+		{"1e-9223372036854775808", ErrRange},
+		{"0e-9223372036854775808", ErrRange},
+		{"1e9223372036854775807", ErrRange},
+		{"1e99999999999999999999", ErrSyntax},
+		{"0e-19", ErrRange},
+	} {
+		if _, err := Parse(tc.in); !errors.Is(err, tc.want) {
+			t.Errorf("Parse(%q): %v, want %v", tc.in, err, tc.want)
+		}
+	}
+}
+
+func TestScaleLimits(t *testing.T) {
+	if s := New(1, 25).Scale(); s != MaxScale {
+		t.Errorf("New(1, 25) has scale %d, want %d", s, MaxScale)
+	}
+	if s := New(1, -3).Scale(); s != 0 {
+		t.Errorf("New(1, -3) has scale %d, want 0", s)
+	}
+	if s := FromFloatScale(1.5, 40).Scale(); s != MaxScale {
+		t.Errorf("FromFloatScale(1.5, 40) has scale %d, want %d", s, MaxScale)
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	for _, tc := range []struct {
+		in   float64
+		want string
+	}{
+		{145.3, "145.3"},
+		{0.1, "0.1"},
+		{-2729.89, "-2729.89"},
+		{1e-30, "0.000000000000000000"},
+		{123456789.123456789, "123456789.12345679"},
+		{1e18, "1000000000000000000"},
+	} {
+		d, err := FromFloat(tc.in)
+		if err != nil {
+			t.Errorf("FromFloat(%v): %v", tc.in, err)
+			continue
+		}
+		if d.String() != tc.want {
+			t.Errorf("FromFloat(%v) = %s, want %s", tc.in, d, tc.want)
+		}
+	}
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), 1e300, -1e19, 1 << 63} {
+		if _, err := FromFloat(f); !errors.Is(err, ErrRange) {
+			t.Errorf("FromFloat(%v): %v, want ErrRange", f, err)
+		}
+	}
+}
+
+func TestFromFloatScaleSaturates(t *testing.T) {
+	if u := FromFloatScale(1e300, 2).Units(); u != math.MaxInt64 {
+		t.Errorf("FromFloatScale(1e300, 2) has units %d", u)
+	}
+	if u := FromFloatScale(-1e300, 2).Units(); u != math.MinInt64 {
+		t.Errorf("FromFloatScale(-1e300, 2) has units %d", u)
+	}
+	if u := FromFloatScale(math.NaN(), 2).Units(); u != 0 {
+		t.Errorf("FromFloatScale(NaN, 2) has units %d", u)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type quote struct {
+		Price Decimal `json:"price"`
+	}
+	for _, in := range []string{"145.30", "-0.001", "0", "1.500000000000000000"} {
+		data, err := json.Marshal(quote{Price: MustParse(in)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"price":` + in + `}`; string(data) != want {
+			t.Errorf("Marshal(%s) = %s, want %s", in, data, want)
+		}
+		var back quote
+		if err := json.Unmarshal(data, &back); err != nil {
+			t.Fatal(err)
+		}
+		if back.Price != MustParse(in) {
+			t.Errorf("round trip of %s gave %s at scale %d", in, back.Price, back.Price.Scale())
+		}
+	}
+
+	var q quote
+	if err := json.Unmarshal([]byte(`{"price":"2729.89"}`), &q); err != nil || q.Price.String() != "2729.89" {
+		t.Errorf("string price: %s, %v", q.Price, err)
+	}
+	if err := json.Unmarshal([]byte(`{"price":null}`), &q); err != nil || q.Price.String() != "2729.89" {
+		t.Errorf("null changed the price to %s, %v", q.Price, err)
+	}
+	if err := json.Unmarshal([]byte(`{"price":"abc"}`), &q); !errors.Is(err, ErrSyntax) {
+		t.Errorf("invalid price: %v", err)
+	}
+}
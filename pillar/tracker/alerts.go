@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+type AlertKind int
+
+const (
+	// CrossAbove fires when the price moves from below Level to at or
+	// above it.
+	CrossAbove AlertKind = iota
+	// CrossBelow fires when the price moves from above Level to at or
+	// below it.
+	CrossBelow
+	// Move fires when the price has moved by at least Percent (in either
+	// direction) relative to the price in effect Window ago. It re-arms
+	// once the move drops back under Percent.
+	Move
+)
+
+// Alert describes a condition on one asset's current price. Events are
+// delivered to Func, to C, or both. Sends on C never block: if the
+// channel is full the event is dropped so a slow reader can't stall
+// Update.
+type Alert struct {
+	CompanyId string
+	Kind      AlertKind
+	Level     decimal.Decimal
+	Percent   float64
+	Window    time.Duration
+
+	C    chan<- AlertEvent
+	Func func(AlertEvent)
+}
+
+// AlertEvent is sent when an alert triggers. Reference is the level that
+// was crossed, or for Move alerts the price the move is measured from.
+type AlertEvent struct {
+	AlertId   int
+	Alert     Alert
+	Price     Price
+	Reference decimal.Decimal
+}
+
+type alertState struct {
+	id    int
+	alert Alert
+	fired bool // Move alerts only: waiting to re-arm
+}
+
+// alertRegistry maps alert ids to the asset they watch so RemoveAlert can
+// find the right shard.
+type alertRegistry struct {
+	mu     sync.Mutex
+	nextId int
+	owners map[int]string
+}
+
+// AddAlert registers an alert and returns its id. Alerts are stored in the
+// shard of the asset they watch, so updates to assets without alerts pay
+// nothing more than a map lookup.
+func (t *tracker) AddAlert(alert Alert) (int, error) {
+	switch {
+	case alert.CompanyId == "":
+		return 0, fmt.Errorf("%w: alert has no company id", ErrInvalidInput)
+	case alert.Kind < CrossAbove || alert.Kind > Move:
+		return 0, fmt.Errorf("%w: unknown alert kind %d", ErrInvalidInput, alert.Kind)
+	case alert.C == nil && alert.Func == nil:
+		return 0, fmt.Errorf("%w: alert has no channel or callback", ErrInvalidInput)
+	case alert.Kind == Move && (alert.Percent <= 0 || alert.Window <= 0):
+		return 0, fmt.Errorf("%w: move alert needs a positive percent and window", ErrInvalidInput)
+	}
+
+	t.alerts.mu.Lock()
+	t.alerts.nextId++
+	id := t.alerts.nextId
+	t.alerts.owners[id] = alert.CompanyId
+	t.alerts.mu.Unlock()
+
+	s := t.shardFor(alert.CompanyId)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts[alert.CompanyId] = append(s.alerts[alert.CompanyId], &alertState{id: id, alert: alert})
+	return id, nil
+}
+
+func (t *tracker) RemoveAlert(id int) error {
+	t.alerts.mu.Lock()
+	companyId, ok := t.alerts.owners[id]
+	delete(t.alerts.owners, id)
+	t.alerts.mu.Unlock()
+	if !ok {
+		return errors.New("alert does not exist")
+	}
+
+	s := t.shardFor(companyId)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := s.alerts[companyId]
+	for i, st := range states {
+		if st.id == id {
+			states = append(states[:i:i], states[i+1:]...)
+			break
+		}
+	}
+	if len(states) == 0 {
+		delete(s.alerts, companyId)
+	} else {
+		s.alerts[companyId] = states
+	}
+	return nil
+}
+
+// evaluateAlerts checks the asset's alerts after its current price moved
+// from prev. The caller holds the shard lock and delivers the returned
+// events once it has released it.
+func evaluateAlerts(states []*alertState, a *asset, prev *Price) []AlertEvent {
+	var events []AlertEvent
+	cur := a.current
+	for _, st := range states {
+		al := st.alert
+		switch al.Kind {
+		case CrossAbove:
+			if prev != nil && prev.Price.Cmp(al.Level) < 0 && cur.Price.Cmp(al.Level) >= 0 {
+				events = append(events, AlertEvent{AlertId: st.id, Alert: al, Price: *cur, Reference: al.Level})
+			}
+		case CrossBelow:
+			if prev != nil && prev.Price.Cmp(al.Level) > 0 && cur.Price.Cmp(al.Level) <= 0 {
+				events = append(events, AlertEvent{AlertId: st.id, Alert: al, Price: *cur, Reference: al.Level})
+			}
+		case Move:
+			ref, ok := a.timeline.at(cur.Timestamp - int(al.Window/time.Second))
+			if !ok || ref.Price.IsZero() {
+				continue
+			}
+			change := cur.Price.Sub(ref.Price).Float64() / ref.Price.Float64()
+			moved := math.Abs(change)*100 >= al.Percent
+			if moved && !st.fired {
+				events = append(events, AlertEvent{AlertId: st.id, Alert: al, Price: *cur, Reference: ref.Price})
+			}
+			st.fired = moved
+		}
+	}
+	return events
+}
+
+func deliverAlerts(events []AlertEvent) {
+	for _, ev := range events {
+		if ev.Alert.Func != nil {
+			ev.Alert.Func(ev)
+		}
+		if ev.Alert.C != nil {
+			select {
+			case ev.Alert.C <- ev:
+			default:
+			}
+		}
+	}
+}
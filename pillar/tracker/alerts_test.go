@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+// alertLog collects the prices of the events an alert fires.
+type alertLog struct {
+	prices []string
+}
+
+func (l *alertLog) add(ev AlertEvent) {
+	l.prices = append(l.prices, ev.Price.Price.String())
+}
+
+func addAlert(t *testing.T, tr *tracker, alert Alert) (int, *alertLog) {
+	t.Helper()
+	log := &alertLog{}
+	alert.CompanyId = "AAPL"
+	alert.Func = log.add
+	id, err := tr.AddAlert(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, log
+}
+
+func TestCrossAlerts(t *testing.T) {
+	tr := AssetPriceTracker()
+	_, above := addAlert(t, tr, Alert{Kind: CrossAbove, Level: decimal.MustParse("100")})
+	_, below := addAlert(t, tr, Alert{Kind: CrossBelow, Level: decimal.MustParse("100")})
+
+	// the first price crosses nothing, and touching the level counts
+	for i, price := range []float64{120, 110, 90, 100, 99, 101, 100, 100} {
+		if err := tr.Update(i+1, "AAPL", price); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fmt.Sprint(above.prices); got != "[100 101]" {
+		t.Errorf("cross above fired at %s, want [100 101]", got)
+	}
+	if got := fmt.Sprint(below.prices); got != "[90 100]" {
+		t.Errorf("cross below fired at %s, want [90 100]", got)
+	}
+}
+
+func TestMoveAlertRearms(t *testing.T) {
+	tr := AssetPriceTracker()
+	_, log := addAlert(t, tr, Alert{Kind: Move, Percent: 10, Window: 10 * time.Second})
+
+	// moves are measured against the price 10s before each update
+	for _, u := range []struct {
+		ts    int
+		price float64
+	}{
+		{0, 100},
+		{10, 105},  // +5% from 100
+		{11, 111},  // +11% from 100: fires
+		{12, 112},  // still moved, already fired
+		{21, 105},  // -5.4% from 111: re-arms
+		{22, 94},   // -16% from 112: fires
+		{23, 94.5}, // still moved
+	} {
+		if err := tr.Update(u.ts, "AAPL", u.price); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fmt.Sprint(log.prices); got != "[111 94]" {
+		t.Errorf("move fired at %s, want [111 94]", got)
+	}
+}
+
+func TestRemoveAlert(t *testing.T) {
+	tr := AssetPriceTracker()
+	id, log := addAlert(t, tr, Alert{Kind: CrossAbove, Level: decimal.MustParse("10")})
+	_, other := addAlert(t, tr, Alert{Kind: CrossAbove, Level: decimal.MustParse("10")})
+	if err := tr.RemoveAlert(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.RemoveAlert(id); err == nil {
+		t.Error("removing an alert twice succeeded")
+	}
+	tr.Update(1, "AAPL", 5)
+	tr.Update(2, "AAPL", 15)
+	if len(log.prices) != 0 || len(other.prices) != 1 {
+		t.Errorf("removed alert fired %v, other alert fired %v", log.prices, other.prices)
+	}
+}
+
+// A full channel drops events rather than blocking the update.
+func TestAlertChannelNeverBlocks(t *testing.T) {
+	tr := AssetPriceTracker()
+	c := make(chan AlertEvent, 1)
+	_, err := tr.AddAlert(Alert{CompanyId: "AAPL", Kind: CrossAbove, Level: decimal.MustParse("10"), C: c})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 10 {
+			tr.Update(2*i+1, "AAPL", 5)
+			tr.Update(2*i+2, "AAPL", 15)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Update blocked on a full alert channel")
+	}
+	if len(c) != 1 {
+		t.Errorf("%d events buffered, want 1", len(c))
+	}
+	if ev := <-c; !ev.Price.Price.Equal(decimal.MustParse("15")) || ev.Price.Timestamp != 2 {
+		t.Errorf("buffered event %+v, want the first crossing", ev)
+	}
+}
+
+func TestAddAlertValidates(t *testing.T) {
+	f := func(AlertEvent) {}
+	for _, alert := range []Alert{
+		{Kind: CrossAbove, Func: f},
+		{CompanyId: "AAPL", Kind: AlertKind(7), Func: f},
+		{CompanyId: "AAPL", Kind: AlertKind(-1), Func: f},
+		{CompanyId: "AAPL", Kind: CrossAbove},
+		{CompanyId: "AAPL", Kind: Move, Window: time.Second, Func: f},
+		{CompanyId: "AAPL", Kind: Move, Percent: 1, Func: f},
+	} {
+		if _, err := AssetPriceTracker().AddAlert(alert); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("AddAlert(%+v): error %v, want ErrInvalidInput", alert, err)
+		}
+	}
+}
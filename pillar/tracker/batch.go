@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+// ingestChunk is how many parsed lines IngestCSV and IngestNDJSON hand to
+// RecordBatch at a time, bounding memory for very large files.
+const ingestChunk = 8192
+
+// BatchResult reports what happened to a batch of ticks. Errors holds one
+// entry per rejected tick.
+type BatchResult struct {
+	Accepted int          `json:"accepted"`
+	Rejected int          `json:"rejected"`
+	Errors   []BatchError `json:"errors,omitempty"`
+}
+
+// BatchError locates a rejected tick by its position in the batch, or by
+// its 1-based line number for file input.
+type BatchError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+func (r *BatchResult) reject(index int, err error) {
+	r.Rejected++
+	r.Errors = append(r.Errors, BatchError{Index: index, Error: err.Error()})
+}
+
+// lineBatch feeds parsed file lines to RecordBatch in chunks, mapping
+// batch positions in the errors back to line numbers.
+type lineBatch struct {
+	tracker *tracker
+	result  BatchResult
+	ticks   []Tick
+	lines   []int
+}
+
+func (b *lineBatch) add(line int, tick Tick) {
+	b.ticks = append(b.ticks, tick)
+	b.lines = append(b.lines, line)
+	if len(b.ticks) == ingestChunk {
+		b.flush()
+	}
+}
+
+func (b *lineBatch) flush() {
+	res := b.tracker.RecordBatch(b.ticks)
+	b.result.Accepted += res.Accepted
+	b.result.Rejected += res.Rejected
+	for _, e := range res.Errors {
+		b.result.Errors = append(b.result.Errors, BatchError{Index: b.lines[e.Index], Error: e.Error})
+	}
+	b.ticks, b.lines = b.ticks[:0], b.lines[:0]
+}
+
+// RecordBatch applies ticks with the same semantics as calling Record on
+// each in order, but takes every shard lock only once and writes the
+// write-ahead log once per shard.
+func (t *tracker) RecordBatch(ticks []Tick) BatchResult {
+	var result BatchResult
+	prepared := make([]Tick, len(ticks))
+	shardOf := make([]uint32, len(ticks))
+	// starts[idx+1] counts the valid ticks in shard idx, then becomes
+	// where the shard's ticks begin in order
+	starts := make([]int, len(t.shards)+1)
+	for i, tick := range ticks {
+		tick, err := t.prepare(tick)
+		if err != nil {
+			result.reject(i, err)
+			shardOf[i] = uint32(len(t.shards))
+			continue
+		}
+		prepared[i] = tick
+		shardOf[i] = fnv32a(tick.CompanyId) & t.shardMask
+		starts[shardOf[i]+1]++
+	}
+	for idx := range t.shards {
+		starts[idx+1] += starts[idx]
+	}
+	order := make([]int, starts[len(t.shards)])
+	next := slices.Clone(starts[:len(t.shards)])
+	for i, idx := range shardOf {
+		if int(idx) < len(t.shards) {
+			order[next[idx]] = i
+			next[idx]++
+		}
+	}
+
+	var events []AlertEvent
+	var logged []Tick
+	var loggedIdx []int
+	for idx, s := range t.shards {
+		indices := order[starts[idx]:starts[idx+1]]
+		if len(indices) == 0 {
+			continue
+		}
+		logged, loggedIdx = logged[:0], loggedIdx[:0]
+
+		s.mu.Lock()
+		for _, i := range indices {
+			tick := prepared[i]
+			a := t.assetFor(s, tick.CompanyId)
+			prev := a.current
+			if err := t.apply(a, tick); err != nil {
+				result.reject(i, err)
+				continue
+			}
+			logged = append(logged, tick)
+			loggedIdx = append(loggedIdx, i)
+			if states := s.alerts[tick.CompanyId]; len(states) > 0 && a.current != prev {
+				events = append(events, evaluateAlerts(states, a, prev)...)
+			}
+		}
+		err := t.wal.append(logged...)
+		s.mu.Unlock()
+
+		if err != nil {
+			// the ticks are applied in memory but not durable; report
+			// them as failed the same way Record would
+			for _, i := range loggedIdx {
+				result.reject(i, err)
+			}
+			continue
+		}
+		result.Accepted += len(logged)
+	}
+	deliverAlerts(events)
+
+	sortErrors(result.Errors)
+	return result
+}
+
+// IngestCSV reads lines of timestamp,asset_id,price with optional vendor
+// and qty columns. A first line whose first field isn't a number is taken
+// as a header and skipped. Malformed lines are reported in the result;
+// the error is only set if reading r fails.
+func (t *tracker) IngestCSV(r io.Reader) (BatchResult, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	b := &lineBatch{tracker: t}
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			b.result.reject(parseErr.Line, fmt.Errorf("%w: %v", ErrInvalidInput, err))
+			continue
+		}
+		if err != nil {
+			b.flush()
+			return b.result, err
+		}
+
+		// blank lines and quoted newlines mean records and lines don't
+		// line up, so ask the reader where this record started
+		line, _ := cr.FieldPos(0)
+		if first && isHeader(record) {
+			continue
+		}
+		tick, err := parseCSVTick(record)
+		if err != nil {
+			b.result.reject(line, err)
+			continue
+		}
+		b.add(line, tick)
+	}
+	b.flush()
+	sortErrors(b.result.Errors)
+	return b.result, nil
+}
+
+func isHeader(record []string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(record[0]), 64)
+	return err != nil
+}
+
+func parseCSVTick(record []string) (Tick, error) {
+	if len(record) < 3 || len(record) > 5 {
+		return Tick{}, fmt.Errorf("%w: expected 3 to 5 fields, got %d", ErrInvalidInput, len(record))
+	}
+	timestamp, err := strconv.Atoi(strings.TrimSpace(record[0]))
+	if err != nil {
+		return Tick{}, fmt.Errorf("%w: timestamp %q", ErrInvalidInput, record[0])
+	}
+	price, err := decimal.Parse(strings.TrimSpace(record[2]))
+	if err != nil {
+		return Tick{}, fmt.Errorf("%w: price %q", ErrInvalidInput, record[2])
+	}
+	tick := Tick{
+		Timestamp: timestamp,
+		CompanyId: strings.TrimSpace(record[1]),
+		Price:     price,
+	}
+	if len(record) > 3 {
+		tick.Vendor = strings.TrimSpace(record[3])
+	}
+	if len(record) > 4 && strings.TrimSpace(record[4]) != "" {
+		if tick.Qty, err = strconv.ParseFloat(strings.TrimSpace(record[4]), 64); err != nil {
+			return Tick{}, fmt.Errorf("%w: qty %q", ErrInvalidInput, record[4])
+		}
+	}
+	return tick, nil
+}
+
+// IngestNDJSON reads one JSON-encoded Tick per line. Blank lines are
+// skipped; malformed lines are reported in the result.
+func (t *tracker) IngestNDJSON(r io.Reader) (BatchResult, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+
+	b := &lineBatch{tracker: t}
+	for line := 1; sc.Scan(); line++ {
+		data := bytes.TrimSpace(sc.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var tick Tick
+		if err := json.Unmarshal(data, &tick); err != nil {
+			if !errors.Is(err, ErrInvalidInput) {
+				err = fmt.Errorf("%w: %v", ErrInvalidInput, err)
+			}
+			b.result.reject(line, err)
+			continue
+		}
+		b.add(line, tick)
+	}
+	b.flush()
+	sortErrors(b.result.Errors)
+	return b.result, sc.Err()
+}
+
+func sortErrors(errs []BatchError) {
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Index < errs[j].Index })
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+func TestIngestCSVReportsLineNumbers(t *testing.T) {
+	input := "timestamp,asset_id,price\n" +
+		"1,AAPL,1\n" +
+		"\n" +
+		"2,AAPL,x\n" +
+		"3,AAPL,2,\"multi\nline vendor\"\n" +
+		"4,AAPL,\n" +
+		"5,AAPL,\"3\n"
+	res, err := AssetPriceTracker().IngestCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Accepted != 2 {
+		t.Errorf("accepted %d, want 2", res.Accepted)
+	}
+	var lines []int
+	for _, e := range res.Errors {
+		lines = append(lines, e.Index)
+	}
+	if want := []int{4, 7, 8}; fmt.Sprint(lines) != fmt.Sprint(want) {
+		t.Errorf("error lines %v, want %v: %+v", lines, want, res.Errors)
+	}
+}
+
+// Only a first line that isn't data is a header; a bad first data line is
+// reported like any other.
+func TestIngestCSVHeader(t *testing.T) {
+	for _, tc := range []struct {
+		input              string
+		accepted, rejected int
+	}{
+		{"timestamp,asset_id,price\n1,AAPL,1\n", 1, 0},
+		{"1,AAPL,1\n2,AAPL,2\n", 2, 0},
+		{"1,AAPL,x\n2,AAPL,2\n", 1, 1},
+		{"1,AAPL\n2,AAPL,2\n", 1, 1},
+		{"1.5,AAPL,1\n2,AAPL,2\n", 1, 1},
+	} {
+		res, err := AssetPriceTracker().IngestCSV(strings.NewReader(tc.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Accepted != tc.accepted || res.Rejected != tc.rejected {
+			t.Errorf("%q: %+v, want %d accepted and %d rejected", tc.input, res, tc.accepted, tc.rejected)
+		}
+		if tc.rejected > 0 && res.Errors[0].Index != 1 {
+			t.Errorf("%q: error on line %d, want 1", tc.input, res.Errors[0].Index)
+		}
+	}
+}
+
+func TestRecordBatchMatchesRecord(t *testing.T) {
+	ticks := []Tick{
+		{Timestamp: 2, CompanyId: "AAPL", Price: decimal.MustParse("10")},
+		{Timestamp: 1, CompanyId: "AAPL", Price: decimal.MustParse("9")},
+		{Timestamp: 3, CompanyId: "GOOG", Price: decimal.MustParse("-1")},
+		{Timestamp: 3, CompanyId: "", Price: decimal.MustParse("1")},
+	}
+	res := AssetPriceTracker(WithLatePolicy(RejectLate)).RecordBatch(ticks)
+	if res.Accepted != 1 || res.Rejected != 3 {
+		t.Fatalf("result %+v", res)
+	}
+	for i, e := range res.Errors {
+		if e.Index != i+1 {
+			t.Errorf("error %d at index %d, want %d", i, e.Index, i+1)
+		}
+	}
+}
+
+func TestRecordBatchStateMatchesRecord(t *testing.T) {
+	var ticks []Tick
+	for i := range 500 {
+		ticks = append(ticks, Tick{
+			Timestamp: (i * 7919) % 300, // out of order, with duplicates
+			CompanyId: fmt.Sprintf("A%d", i%13),
+			Vendor:    fmt.Sprintf("v%d", i%3),
+			Price:     decimal.New(int64(i%17+1), 1),
+		})
+	}
+	batch, loop := persistedTracker(), persistedTracker()
+	res := batch.RecordBatch(ticks)
+	for _, tick := range ticks {
+		loop.Record(tick)
+	}
+	if res.Accepted+res.Rejected != len(ticks) {
+		t.Errorf("result %+v doesn't account for %d ticks", res, len(ticks))
+	}
+	for i := range 13 {
+		id := fmt.Sprintf("A%d", i)
+		if got, want := describe(t, batch, id), describe(t, loop, id); got != want {
+			t.Errorf("%s after RecordBatch:\n%s\nwant:\n%s", id, got, want)
+		}
+	}
+}
+
+func benchTicks(n int) []Tick {
+	ids := benchIds(256)
+	ticks := make([]Tick, n)
+	for i := range ticks {
+		ticks[i] = Tick{Timestamp: i + 1, CompanyId: ids[i%len(ids)], Price: decimal.MustParse("100.25")}
+	}
+	return ticks
+}
+
+// BenchmarkRecordBatch compares RecordBatch with calling Record on each
+// tick, with and without a write-ahead log. Each iteration starts from an
+// empty tracker, built off the clock.
+func BenchmarkRecordBatch(b *testing.B) {
+	record := map[string]func(*tracker, []Tick){
+		"batch": func(tr *tracker, ticks []Tick) { tr.RecordBatch(ticks) },
+		"loop": func(tr *tracker, ticks []Tick) {
+			for _, tick := range ticks {
+				tr.Record(tick)
+			}
+		},
+	}
+	for _, wal := range []bool{false, true} {
+		for _, size := range []int{100, 1000, 10000} {
+			ticks := benchTicks(size)
+			for _, mode := range []string{"batch", "loop"} {
+				b.Run(fmt.Sprintf("wal=%t/%s=%d", wal, mode, size), func(b *testing.B) {
+					path := filepath.Join(b.TempDir(), "bench.wal")
+					b.ReportAllocs()
+					for range b.N {
+						b.StopTimer()
+						tr := AssetPriceTracker()
+						if wal {
+							if err := tr.OpenWAL(path); err != nil {
+								b.Fatal(err)
+							}
+						}
+						b.StartTimer()
+						record[mode](tr, ticks)
+						b.StopTimer()
+						tr.CloseWAL()
+						os.Remove(path)
+						b.StartTimer()
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+const defaultMaxCandles = 1000
+
+// Candle is an open/high/low/close bar covering [Start, Start+Interval).
+type Candle struct {
+	Start    int             `json:"start"`
+	Interval time.Duration   `json:"-"`
+	Open     decimal.Decimal `json:"open"`
+	High     decimal.Decimal `json:"high"`
+	Low      decimal.Decimal `json:"low"`
+	Close    decimal.Decimal `json:"close"`
+	Count    int             `json:"count"`
+
+	// timestamps of the ticks that set Open and Close, so late ticks
+	// landing in an existing bar still produce the right open and close
+	openAt  int
+	closeAt int
+}
+
+// candleSeries holds the most recent bars for one interval as a ring
+// buffer, oldest first starting at head.
+type candleSeries struct {
+	interval time.Duration
+	bars     []Candle
+	head     int
+}
+
+// WithCandles turns on OHLC aggregation for the given intervals, keeping
+// the most recent maxCandles bars per interval and asset. Tick timestamps
+// are in seconds, so intervals are truncated to whole seconds and any
+// shorter than a second are ignored.
+func WithCandles(maxCandles int, intervals ...time.Duration) Option {
+	return func(t *tracker) {
+		if maxCandles <= 0 {
+			maxCandles = defaultMaxCandles
+		}
+		t.maxCandles = maxCandles
+		t.candleIntervals = nil
+		for _, d := range intervals {
+			if d = d.Truncate(time.Second); d > 0 {
+				t.candleIntervals = append(t.candleIntervals, d)
+			}
+		}
+	}
+}
+
+func (t *tracker) newCandleSeries() []*candleSeries {
+	if len(t.candleIntervals) == 0 {
+		return nil
+	}
+	series := make([]*candleSeries, len(t.candleIntervals))
+	for i, d := range t.candleIntervals {
+		series[i] = &candleSeries{interval: d}
+	}
+	return series
+}
+
+// add folds a tick into the bar for its interval. A late tick only
+// updates a bar that already exists; if its bar was never opened or has
+// been evicted, it is ignored.
+func (c *candleSeries) add(p Price, maxCandles int) {
+	width := int(c.interval / time.Second)
+	start := p.Timestamp - p.Timestamp%width
+
+	n := len(c.bars)
+	if n == 0 || start > c.newest().Start {
+		c.push(Candle{
+			Start:    start,
+			Interval: c.interval,
+			Open:     p.Price,
+			High:     p.Price,
+			Low:      p.Price,
+			Close:    p.Price,
+			Count:    1,
+			openAt:   p.Timestamp,
+			closeAt:  p.Timestamp,
+		}, maxCandles)
+		return
+	}
+
+	// bars are kept in start order, so walk back from the newest
+	for i := n - 1; i >= 0; i-- {
+		bar := &c.bars[(c.head+i)%n]
+		if bar.Start > start {
+			continue
+		}
+		if bar.Start < start {
+			// the bar for this tick was never opened, or has been evicted
+			return
+		}
+		bar.Count++
+		if p.Price.Cmp(bar.High) > 0 {
+			bar.High = p.Price
+		}
+		if p.Price.Cmp(bar.Low) < 0 {
+			bar.Low = p.Price
+		}
+		if p.Timestamp < bar.openAt {
+			bar.Open, bar.openAt = p.Price, p.Timestamp
+		}
+		if p.Timestamp >= bar.closeAt {
+			bar.Close, bar.closeAt = p.Price, p.Timestamp
+		}
+		return
+	}
+}
+
+func (c *candleSeries) newest() *Candle {
+	n := len(c.bars)
+	return &c.bars[(c.head+n-1)%n]
+}
+
+func (c *candleSeries) push(bar Candle, maxCandles int) {
+	if len(c.bars) < maxCandles {
+		c.bars = append(c.bars, bar)
+		return
+	}
+	c.bars[c.head] = bar
+	c.head = (c.head + 1) % len(c.bars)
+}
+
+// last returns up to n of the most recent bars, oldest first.
+func (c *candleSeries) last(n int) []Candle {
+	if n > len(c.bars) || n <= 0 {
+		n = len(c.bars)
+	}
+	out := make([]Candle, n)
+	for i := range out {
+		out[i] = c.bars[(c.head+len(c.bars)-n+i)%len(c.bars)]
+	}
+	return out
+}
+
+// GetCandles returns the last n bars of the given interval for the
+// company, oldest first. n <= 0 returns every retained bar.
+func (t *tracker) GetCandles(companyId string, interval time.Duration, n int) ([]Candle, error) {
+	s := t.shardFor(companyId)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.assets[companyId]
+	if !ok {
+		return nil, ErrUnknownAsset
+	}
+	for _, c := range a.candles {
+		if c.interval == interval {
+			return c.last(n), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: candle interval %s not configured", ErrInvalidInput, interval)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func candleString(c Candle) string {
+	return fmt.Sprintf("%d o=%s h=%s l=%s c=%s n=%d", c.Start, c.Open, c.High, c.Low, c.Close, c.Count)
+}
+
+func TestCandleBucketing(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		maxCandles int
+		updates    [][2]int // timestamp, price
+		want       []string
+	}{
+		{
+			name:    "in order",
+			updates: [][2]int{{60, 5}, {61, 7}, {119, 4}, {120, 6}},
+			want:    []string{"60 o=5 h=7 l=4 c=4 n=3", "120 o=6 h=6 l=6 c=6 n=1"},
+		},
+		{
+			name:    "late tick updates its bar",
+			updates: [][2]int{{65, 5}, {70, 6}, {130, 9}, {60, 3}, {66, 8}},
+			want:    []string{"60 o=3 h=8 l=3 c=6 n=4", "120 o=9 h=9 l=9 c=9 n=1"},
+		},
+		{
+			name:    "late tick for a bar never opened",
+			updates: [][2]int{{10, 1}, {130, 2}, {70, 5}},
+			want:    []string{"0 o=1 h=1 l=1 c=1 n=1", "120 o=2 h=2 l=2 c=2 n=1"},
+		},
+		{
+			name:       "late tick for an evicted bar",
+			maxCandles: 2,
+			updates:    [][2]int{{0, 1}, {60, 2}, {120, 3}, {30, 9}},
+			want:       []string{"60 o=2 h=2 l=2 c=2 n=1", "120 o=3 h=3 l=3 c=3 n=1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := AssetPriceTracker(WithCandles(tc.maxCandles, time.Minute))
+			for _, u := range tc.updates {
+				if err := tr.Update(u[0], "AAPL", float64(u[1])); err != nil {
+					t.Fatal(err)
+				}
+			}
+			candles, err := tr.GetCandles("AAPL", time.Minute, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range candles {
+				got = append(got, candleString(c))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("candles\n got %v\nwant %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetCandlesLimitsAndIntervals(t *testing.T) {
+	tr := AssetPriceTracker(WithCandles(0, 500*time.Millisecond, time.Minute))
+	for ts := range 5 {
+		tr.Update(ts*60, "AAPL", float64(ts))
+	}
+	candles, err := tr.GetCandles("AAPL", time.Minute, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 2 || candles[0].Start != 180 || candles[1].Start != 240 {
+		t.Errorf("last 2 candles %v", candles)
+	}
+	// sub-second intervals are dropped since timestamps are in seconds
+	if _, err := tr.GetCandles("AAPL", 500*time.Millisecond, 0); err == nil {
+		t.Error("sub-second interval was configured")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+var (
+	// ErrUnknownAsset is returned for a company the tracker has never
+	// seen an update for.
+	ErrUnknownAsset = errors.New("company does not exist")
+	// ErrNoPrice is returned when the company is known but has no price
+	// matching the query, e.g. before its first update.
+	ErrNoPrice = errors.New("no price")
+	// ErrStalePrice matches every *StalePriceError with errors.Is.
+	ErrStalePrice = errors.New("price is stale")
+	// ErrInvalidInput wraps every validation failure.
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrNoFXRate is returned when a price can't be converted because no
+	// tracked FX asset links the two currencies.
+	ErrNoFXRate = errors.New("no fx rate")
+	// ErrLateUpdate is returned by Update when the tracker is configured
+	// with RejectLate and the update is older than the vendor's latest
+	// price.
+	ErrLateUpdate = errors.New("update is older than current price")
+)
+
+// ValidationPolicy controls which updates Record accepts. Empty company
+// ids and NaN or infinite quantities are always rejected; the zero value
+// additionally rejects negative prices and quantities.
+type ValidationPolicy struct {
+	// AllowNegative accepts negative prices, for instruments such as
+	// spreads that can trade below zero.
+	AllowNegative bool
+	// RejectZero rejects prices of exactly zero.
+	RejectZero bool
+	// MaxPrice rejects prices above it. Zero means no limit.
+	MaxPrice decimal.Decimal
+}
+
+func WithValidation(p ValidationPolicy) Option {
+	return func(t *tracker) {
+		t.validation = p
+	}
+}
+
+func (v ValidationPolicy) check(tick Tick) error {
+	switch {
+	case tick.CompanyId == "":
+		return fmt.Errorf("%w: empty company id", ErrInvalidInput)
+	case math.IsNaN(tick.Qty) || math.IsInf(tick.Qty, 0) || tick.Qty < 0:
+		return fmt.Errorf("%w: quantity %v for %s", ErrInvalidInput, tick.Qty, tick.CompanyId)
+	}
+	if !v.validPrice(tick.Price) {
+		return v.priceError(tick.CompanyId, tick.Price)
+	}
+	return nil
+}
+
+// validPrice is the allocation-free part of check, for hot paths that
+// only build the error once they know the price is bad.
+func (v ValidationPolicy) validPrice(price decimal.Decimal) bool {
+	return (price.Sign() >= 0 || v.AllowNegative) &&
+		(!price.IsZero() || !v.RejectZero) &&
+		(v.MaxPrice.Sign() <= 0 || price.Cmp(v.MaxPrice) <= 0)
+}
+
+func (v ValidationPolicy) priceError(companyId string, price decimal.Decimal) error {
+	switch {
+	case price.Sign() < 0:
+		return fmt.Errorf("%w: negative price %v for %s", ErrInvalidInput, price, companyId)
+	case price.IsZero():
+		return fmt.Errorf("%w: zero price for %s", ErrInvalidInput, companyId)
+	}
+	return fmt.Errorf("%w: price %v for %s above limit %v", ErrInvalidInput, price, companyId, v.MaxPrice)
+}
+
+// PriceResult is one entry of a GetCurrentPrices call. Exactly one of
+// Price and Err is set.
+type PriceResult struct {
+	CompanyId string
+	Price     *Price
+	Err       error
+}
+
+// GetCurrentPrices looks up several companies at once, returning a result
+// per id in the order given.
+func (t *tracker) GetCurrentPrices(companyIds ...string) []PriceResult {
+	results := make([]PriceResult, len(companyIds))
+	for i, id := range companyIds {
+		p, err := t.GetCurrentPrice(id)
+		results[i] = PriceResult{CompanyId: id, Price: p, Err: err}
+	}
+	return results
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// history is the full, timestamp-ordered list of ticks for one asset, as
+// each vendor reported them. Prices are stored by value in a single slice
+// so that millions of updates stay compact.
+type history []filed
+
+// filed is a tick in history. seq is its position in arrival order, which
+// snapshots keep so a restore sees late ticks arrive late again.
+type filed struct {
+	Price
+	seq int
+}
+
+// insert adds p in timestamp order and returns its index. Updates almost
+// always arrive in order, so the common case is an amortised O(1) append;
+// late updates are placed after any existing entries with the same
+// timestamp.
+func (h *history) insert(p Price) int {
+	n := len(*h)
+	f := filed{Price: p, seq: n}
+	if n == 0 || (*h)[n-1].Timestamp <= p.Timestamp {
+		*h = append(*h, f)
+		return n
+	}
+	i := sort.Search(n, func(i int) bool { return (*h)[i].Timestamp > p.Timestamp })
+	*h = append(*h, filed{})
+	copy((*h)[i+1:], (*h)[i:])
+	(*h)[i] = f
+	return i
+}
+
+// arrivals returns the indexes of the ticks in the order they arrived.
+func (h history) arrivals() []int {
+	order := make([]int, len(h))
+	for i, f := range h {
+		order[f.seq] = i
+	}
+	return order
+}
+
+// timeline is the consolidated price of an asset over time, with one
+// point per distinct tick timestamp. It is what GetCurrentPrice reported,
+// or would have reported had every tick arrived in order, so with several
+// vendors it differs from the raw history.
+type timeline []point
+
+type point struct {
+	from  int // the point holds until the next one's from
+	price Price
+}
+
+// at returns the consolidated price in effect at timestamp.
+func (tl timeline) at(timestamp int) (Price, bool) {
+	i := sort.Search(len(tl), func(i int) bool { return tl[i].from > timestamp })
+	if i == 0 {
+		return Price{}, false
+	}
+	return tl[i-1].price, true
+}
+
+// settle brings the timeline up to date after the tick at a.history[i]
+// was filed. A tick at the end of history just extends the timeline with
+// the current price. One filed further back changes the consolidated
+// price from its timestamp until its vendor's next tick, so that stretch
+// is recomputed from the vendors' prices at the time.
+func (a *asset) settle(policy ConsolidationPolicy, i int) {
+	h := a.history
+	p := h[i].Price
+	if i == len(h)-1 {
+		if n := len(a.timeline); n > 0 && a.timeline[n-1].from == p.Timestamp {
+			a.timeline[n-1].price = *a.current
+		} else {
+			a.timeline = append(a.timeline, point{from: p.Timestamp, price: *a.current})
+		}
+		return
+	}
+
+	// each vendor's latest price as of the late tick
+	vendors := make(map[string]*Price, len(a.vendors))
+	for j := i; j >= 0 && len(vendors) < len(a.vendors); j-- {
+		if _, ok := vendors[h[j].Vendor]; !ok {
+			vendors[h[j].Vendor] = &h[j].Price
+		}
+	}
+
+	end, until := len(h), 0
+	for j := i + 1; j < len(h); j++ {
+		if h[j].Vendor == p.Vendor {
+			end, until = j, h[j].Timestamp
+			break
+		}
+	}
+	var points []point
+	for j := i; j < end; j++ {
+		vendors[h[j].Vendor] = &h[j].Price
+		// only the last tick at a timestamp makes a point, and one at the
+		// vendor's next tick is already right
+		if j+1 < len(h) && h[j+1].Timestamp == h[j].Timestamp {
+			continue
+		}
+		points = append(points, point{from: h[j].Timestamp, price: *policy.Consolidate(vendors)})
+	}
+
+	lo := sort.Search(len(a.timeline), func(k int) bool { return a.timeline[k].from >= p.Timestamp })
+	hi := len(a.timeline)
+	if end < len(h) {
+		hi = sort.Search(len(a.timeline), func(k int) bool { return a.timeline[k].from >= until })
+	}
+	a.timeline = append(a.timeline[:lo], append(points, a.timeline[hi:]...)...)
+}
+
+// GetPriceAt returns the consolidated price of the company that was in
+// effect at the given timestamp.
+func (t *tracker) GetPriceAt(companyId string, timestamp int) (*Price, error) {
+	s := t.shardFor(companyId)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.assets[companyId]
+	if !ok {
+		return nil, ErrUnknownAsset
+	}
+	p, ok := a.timeline.at(timestamp)
+	if !ok {
+		return nil, fmt.Errorf("%w at or before %d", ErrNoPrice, timestamp)
+	}
+	return &p, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetPriceAt(t *testing.T) {
+	tr := AssetPriceTracker()
+	for _, u := range []struct {
+		ts    int
+		price float64
+	}{{10, 1}, {20, 2}, {20, 2.5}, {30, 3}} {
+		if err := tr.Update(u.ts, "AAPL", u.price); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		ts   int
+		want string
+		err  error
+	}{
+		{9, "", ErrNoPrice},
+		{10, "1", nil},
+		{19, "1", nil},
+		{20, "2.5", nil},
+		{29, "2.5", nil},
+		{1 << 40, "3", nil},
+	} {
+		p, err := tr.GetPriceAt("AAPL", tc.ts)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("GetPriceAt(%d): error %v, want %v", tc.ts, err, tc.err)
+			continue
+		}
+		if err == nil && p.Price.String() != tc.want {
+			t.Errorf("GetPriceAt(%d) = %s, want %s", tc.ts, p.Price, tc.want)
+		}
+	}
+
+	if _, err := tr.GetPriceAt("GOOG", 10); !errors.Is(err, ErrUnknownAsset) {
+		t.Errorf("unknown asset: error %v, want ErrUnknownAsset", err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+type InstrumentClass int
+
+const (
+	ClassEquity InstrumentClass = iota
+	ClassCrypto
+	ClassFX
+	ClassFuture
+	ClassOption
+)
+
+// AssetInfo describes an asset's price. Currency is the currency the
+// price is quoted in and Decimals how many decimal places it carries. FX
+// assets also set Base: an FX asset with Base "EUR" and Currency "USD"
+// is the price of one euro in dollars.
+type AssetInfo struct {
+	Currency string
+	Decimals int
+	Class    InstrumentClass
+	Base     string
+}
+
+// fxScale is the precision of derived FX rates (inverted or crossed
+// pairs) before they are applied to a price.
+const fxScale = 10
+
+// registry holds asset metadata and indexes FX assets by currency pair.
+type registry struct {
+	mu      sync.RWMutex
+	assets  map[string]AssetInfo
+	fxPairs map[[2]string]string // {base, quote} -> asset id
+}
+
+// RegisterAsset records metadata for an asset, replacing any earlier
+// registration. The asset doesn't need to have a price yet.
+func (t *tracker) RegisterAsset(companyId string, info AssetInfo) error {
+	if companyId == "" || info.Currency == "" {
+		return fmt.Errorf("%w: asset id and currency are required", ErrInvalidInput)
+	}
+	if info.Class == ClassFX && (info.Base == "" || info.Base == info.Currency) {
+		return fmt.Errorf("%w: fx asset %s needs a base currency different from its quote", ErrInvalidInput, companyId)
+	}
+
+	t.registry.mu.Lock()
+	defer t.registry.mu.Unlock()
+	if old, ok := t.registry.assets[companyId]; ok && old.Class == ClassFX {
+		delete(t.registry.fxPairs, [2]string{old.Base, old.Currency})
+	}
+	t.registry.assets[companyId] = info
+	if info.Class == ClassFX {
+		t.registry.fxPairs[[2]string{info.Base, info.Currency}] = companyId
+	}
+	return nil
+}
+
+func (t *tracker) GetAssetInfo(companyId string) (AssetInfo, error) {
+	info, ok := t.assetInfo(companyId)
+	if !ok {
+		return AssetInfo{}, fmt.Errorf("%w: %s is not registered", ErrUnknownAsset, companyId)
+	}
+	return info, nil
+}
+
+// assetInfo is GetAssetInfo for the update path, where most assets may be
+// unregistered and building an error for each would cost an allocation.
+func (t *tracker) assetInfo(companyId string) (AssetInfo, bool) {
+	t.registry.mu.RLock()
+	defer t.registry.mu.RUnlock()
+	info, ok := t.registry.assets[companyId]
+	return info, ok
+}
+
+// GetCurrentPriceIn returns the company's current price converted into
+// currency using the tracked FX assets. A direct or inverse pair is used
+// when one exists, otherwise the conversion goes through one intermediate
+// currency. The result keeps the scale of the company's price and carries
+// the oldest timestamp of the prices used.
+func (t *tracker) GetCurrentPriceIn(companyId, currency string) (*Price, error) {
+	info, err := t.GetAssetInfo(companyId)
+	if err != nil {
+		return nil, err
+	}
+	price, err := t.GetCurrentPrice(companyId)
+	if err != nil {
+		return nil, err
+	}
+	if info.Currency == currency {
+		return price, nil
+	}
+
+	rate, err := t.fxRate(info.Currency, currency)
+	if err != nil {
+		return nil, err
+	}
+	return &Price{
+		Price:     price.Price.Mul(rate.Price, price.Price.Scale()),
+		Timestamp: min(price.Timestamp, rate.Timestamp),
+	}, nil
+}
+
+// fxRate returns the price of one unit of from in to. When there is no
+// direct pair and several intermediate currencies link the two, the route
+// whose older price is freshest wins, ties going to the intermediate
+// currency that sorts first.
+func (t *tracker) fxRate(from, to string) (*Price, error) {
+	if rate, err := t.directRate(from, to); !errors.Is(err, ErrNoFXRate) {
+		return rate, err
+	}
+
+	t.registry.mu.RLock()
+	var via []string
+	for pair := range t.registry.fxPairs {
+		switch from {
+		case pair[0]:
+			via = append(via, pair[1])
+		case pair[1]:
+			via = append(via, pair[0])
+		}
+	}
+	t.registry.mu.RUnlock()
+	slices.Sort(via)
+	via = slices.Compact(via)
+
+	var best *Price
+	for _, mid := range via {
+		first, err := t.directRate(from, mid)
+		if err != nil {
+			continue
+		}
+		second, err := t.directRate(mid, to)
+		if err != nil {
+			continue
+		}
+		if ts := min(first.Timestamp, second.Timestamp); best == nil || ts > best.Timestamp {
+			best = &Price{
+				Price:     first.Price.Mul(second.Price, fxScale),
+				Timestamp: ts,
+			}
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w: %s to %s", ErrNoFXRate, from, to)
+	}
+	return best, nil
+}
+
+// directRate converts using a single FX asset quoted either way round.
+func (t *tracker) directRate(from, to string) (*Price, error) {
+	t.registry.mu.RLock()
+	direct, hasDirect := t.registry.fxPairs[[2]string{from, to}]
+	inverse, hasInverse := t.registry.fxPairs[[2]string{to, from}]
+	t.registry.mu.RUnlock()
+
+	switch {
+	case hasDirect:
+		return t.GetCurrentPrice(direct)
+	case hasInverse:
+		p, err := t.GetCurrentPrice(inverse)
+		if err != nil {
+			return nil, err
+		}
+		rate, err := decimal.New(1, 0).Div(p.Price, fxScale)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s has a zero price", ErrNoFXRate, inverse)
+		}
+		return &Price{Price: rate, Timestamp: p.Timestamp}, nil
+	}
+	return nil, fmt.Errorf("%w: %s to %s", ErrNoFXRate, from, to)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+func TestFXRateCrossRoutesAreDeterministic(t *testing.T) {
+	tr := AssetPriceTracker()
+	for id, info := range map[string]AssetInfo{
+		"EURUSD": {Class: ClassFX, Base: "EUR", Currency: "USD", Decimals: 4},
+		"GBPUSD": {Class: ClassFX, Base: "GBP", Currency: "USD", Decimals: 4},
+		"EURCHF": {Class: ClassFX, Base: "EUR", Currency: "CHF", Decimals: 4},
+		"GBPCHF": {Class: ClassFX, Base: "GBP", Currency: "CHF", Decimals: 4},
+		"EURJPY": {Class: ClassFX, Base: "EUR", Currency: "JPY", Decimals: 2},
+		"GBPJPY": {Class: ClassFX, Base: "GBP", Currency: "JPY", Decimals: 2},
+	} {
+		if err := tr.RegisterAsset(id, info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// EUR to GBP can go via USD, CHF or JPY; the JPY legs are freshest.
+	tr.Update(10, "EURUSD", 1.1)
+	tr.Update(10, "GBPUSD", 1.25)
+	tr.Update(20, "EURCHF", 0.95)
+	tr.Update(5, "GBPCHF", 1.1)
+	tr.Update(30, "EURJPY", 160)
+	tr.Update(25, "GBPJPY", 190)
+
+	// the GBPJPY leg is inverted at fxScale before the legs are multiplied
+	inverse, err := decimal.New(1, 0).Div(decimal.New(190, 0), fxScale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decimal.New(160, 0).Mul(inverse, fxScale)
+	for range 50 {
+		rate, err := tr.fxRate("EUR", "GBP")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate.Timestamp != 25 || !rate.Price.Equal(want) {
+			t.Fatalf("rate %v at %d, want %v at 25", rate.Price, rate.Timestamp, want)
+		}
+	}
+}
+
+func TestUpdateUnregisteredAssetAllocations(t *testing.T) {
+	tr := AssetPriceTracker()
+	tr.RegisterAsset("AAPL", AssetInfo{Currency: "USD", Decimals: 2})
+	ts := 0
+	registered := testing.AllocsPerRun(100, func() { ts++; tr.Update(ts, "AAPL", 1.5) })
+	unregistered := testing.AllocsPerRun(100, func() { ts++; tr.Update(ts, "MSFT", 1.5) })
+	if unregistered > registered {
+		t.Errorf("Update allocates %v times for an unregistered asset, %v for a registered one", unregistered, registered)
+	}
+}
+
+func BenchmarkUpdateRegistered(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		info bool
+	}{{"registered", true}, {"unregistered", false}} {
+		b.Run(tc.name, func(b *testing.B) {
+			tr := AssetPriceTracker()
+			if tc.info {
+				tr.RegisterAsset("AAPL", AssetInfo{Currency: "USD", Decimals: 2})
+			}
+			b.ReportAllocs()
+			for i := range b.N {
+				tr.Update(i+1, "AAPL", 145.30)
+			}
+		})
+	}
+}
+
+// Every way a price can come in stores it at the asset's registered
+// decimals.
+func TestRegisteredDecimalsApplyToEveryIngestPath(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		ingest func(tr *tracker) error
+	}{
+		{"Update", func(tr *tracker) error { return tr.Update(1, "AAPL", 145.305) }},
+		{"Record", func(tr *tracker) error {
+			return tr.Record(Tick{Timestamp: 1, CompanyId: "AAPL", Price: decimal.MustParse("145.305")})
+		}},
+		{"RecordBatch", func(tr *tracker) error {
+			res := tr.RecordBatch([]Tick{{Timestamp: 1, CompanyId: "AAPL", Price: decimal.MustParse("145.305")}})
+			if res.Rejected > 0 {
+				return fmt.Errorf("%+v", res.Errors)
+			}
+			return nil
+		}},
+		{"CSV", func(tr *tracker) error {
+			_, err := tr.IngestCSV(strings.NewReader("1,AAPL,145.305\n"))
+			return err
+		}},
+		{"HTTP", func(tr *tracker) error {
+			rec := serveRequest(t, tr, "POST", "/prices", "", `{"timestamp":1,"asset_id":"AAPL","price":145.305}`)
+			if rec.Code != http.StatusCreated {
+				return fmt.Errorf("status %d: %s", rec.Code, rec.Body)
+			}
+			return nil
+		}},
+	} {
+		tr := AssetPriceTracker()
+		tr.RegisterAsset("AAPL", AssetInfo{Currency: "USD", Decimals: 2})
+		if err := tc.ingest(tr); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		p, err := tr.GetCurrentPrice("AAPL")
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if p.Price.String() != "145.31" {
+			t.Errorf("%s stored %s, want 145.31", tc.name, p.Price)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+// Handle is a dense integer id for an interned asset.
+type Handle uint32
+
+const (
+	compactChunkBits = 12
+	compactChunkSize = 1 << compactChunkBits
+	compactStripes   = 256
+)
+
+// compactTracker is the space-optimised storage mode for very large
+// numbers of assets. Asset ids are interned once into dense handles and
+// the latest price of each asset lives in fixed-size chunks of parallel
+// slices, so there is no per-asset heap object or pointer.
+//
+// It keeps only the latest price per asset; history, vendors, candles and
+// the other tracker features need the full tracker.
+//
+// Chunks never move once allocated and the list of them is replaced
+// wholesale, never modified, when one is added, so updates and reads
+// only take the stripe lock for their handle. The table lock guards
+// interning and the id lookups.
+type compactTracker struct {
+	mu         sync.RWMutex
+	handles    map[string]Handle
+	ids        []string
+	validation ValidationPolicy
+
+	chunks  atomic.Pointer[[]*compactChunk]
+	stripes [compactStripes]sync.Mutex
+	count   atomic.Uint32
+}
+
+type compactChunk struct {
+	units      [compactChunkSize]int64
+	scales     [compactChunkSize]uint8
+	timestamps [compactChunkSize]int64
+	set        [compactChunkSize / 64]uint64
+}
+
+// CompactAssetPriceTracker returns an empty compact tracker that checks
+// prices against validation, as the full tracker does.
+func CompactAssetPriceTracker(validation ValidationPolicy) *compactTracker {
+	c := &compactTracker{handles: make(map[string]Handle), validation: validation}
+	c.chunks.Store(&[]*compactChunk{})
+	return c
+}
+
+// Intern returns the handle for companyId, assigning the next one if the
+// id hasn't been seen before.
+func (c *compactTracker) Intern(companyId string) Handle {
+	c.mu.RLock()
+	h, ok := c.handles[companyId]
+	c.mu.RUnlock()
+	if ok {
+		return h
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if h, ok := c.handles[companyId]; ok {
+		return h
+	}
+	h = Handle(len(c.ids))
+	if chunks := *c.chunks.Load(); int(h)>>compactChunkBits == len(chunks) {
+		grown := append(chunks[:len(chunks):len(chunks)], &compactChunk{})
+		c.chunks.Store(&grown)
+	}
+	c.ids = append(c.ids, companyId)
+	c.handles[companyId] = h
+	c.count.Store(uint32(len(c.ids)))
+	return h
+}
+
+// Lookup returns the handle for an already interned id.
+func (c *compactTracker) Lookup(companyId string) (Handle, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	h, ok := c.handles[companyId]
+	return h, ok
+}
+
+// Id returns the asset id a handle was interned from.
+func (c *compactTracker) Id(h Handle) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if int(h) >= len(c.ids) {
+		return "", false
+	}
+	return c.ids[h], true
+}
+
+// stripe returns the lock guarding h. Handles sharing a word of the set
+// bitmap always share a stripe.
+func (c *compactTracker) stripe(h Handle) *sync.Mutex {
+	return &c.stripes[(h/64)%compactStripes]
+}
+
+// chunk returns the chunk holding h, which the caller has checked is
+// below count; the chunk list is published before count grows.
+func (c *compactTracker) chunk(h Handle) *compactChunk {
+	return (*c.chunks.Load())[h>>compactChunkBits]
+}
+
+// UpdateHandle is the fast path for Update: no string hashing and no
+// allocation. Updates older than the stored price are ignored.
+func (c *compactTracker) UpdateHandle(h Handle, timestamp int, price decimal.Decimal) error {
+	if uint32(h) >= c.count.Load() {
+		return ErrUnknownAsset
+	}
+	if !c.validation.validPrice(price) {
+		id, _ := c.Id(h)
+		return c.validation.priceError(id, price)
+	}
+	ch := c.chunk(h)
+	i := h & (compactChunkSize - 1)
+	word, bit := i/64, uint64(1)<<(i%64)
+
+	mu := c.stripe(h)
+	mu.Lock()
+	defer mu.Unlock()
+	if ch.set[word]&bit != 0 && int64(timestamp) < ch.timestamps[i] {
+		return nil
+	}
+	ch.units[i] = price.Units()
+	ch.scales[i] = uint8(price.Scale())
+	ch.timestamps[i] = int64(timestamp)
+	ch.set[word] |= bit
+	return nil
+}
+
+// CurrentPriceHandle is the fast path for GetCurrentPrice.
+func (c *compactTracker) CurrentPriceHandle(h Handle) (Price, error) {
+	if uint32(h) >= c.count.Load() {
+		return Price{}, ErrUnknownAsset
+	}
+	ch := c.chunk(h)
+	i := h & (compactChunkSize - 1)
+
+	mu := c.stripe(h)
+	mu.Lock()
+	defer mu.Unlock()
+	if ch.set[i/64]&(uint64(1)<<(i%64)) == 0 {
+		return Price{}, ErrNoPrice
+	}
+	return Price{
+		Price:     decimal.New(ch.units[i], int(ch.scales[i])),
+		Timestamp: int(ch.timestamps[i]),
+	}, nil
+}
+
+func (c *compactTracker) Update(timestamp int, companyId string, price float64) error {
+	d, err := decimal.FromFloat(price)
+	if err != nil {
+		return fmt.Errorf("%w: price %v for %s", ErrInvalidInput, price, companyId)
+	}
+	if err := c.validation.check(Tick{Timestamp: timestamp, CompanyId: companyId, Price: d}); err != nil {
+		return err
+	}
+	return c.UpdateHandle(c.Intern(companyId), timestamp, d)
+}
+
+func (c *compactTracker) GetCurrentPrice(companyId string) (*Price, error) {
+	h, ok := c.Lookup(companyId)
+	if !ok {
+		return nil, ErrUnknownAsset
+	}
+	p, err := c.CurrentPriceHandle(h)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+func TestCompactTracker(t *testing.T) {
+	c := CompactAssetPriceTracker(ValidationPolicy{})
+	if err := c.Update(2, "AAPL", 145.30); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Update(1, "AAPL", 140); err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.GetCurrentPrice("AAPL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Timestamp != 2 || p.Price.String() != "145.3" {
+		t.Errorf("current price %v at %d, want 145.3 at 2", p.Price, p.Timestamp)
+	}
+
+	if _, err := c.GetCurrentPrice("GOOG"); !errors.Is(err, ErrUnknownAsset) {
+		t.Errorf("unknown asset: %v", err)
+	}
+	h := c.Intern("GOOG")
+	if _, err := c.CurrentPriceHandle(h); !errors.Is(err, ErrNoPrice) {
+		t.Errorf("interned asset without a price: %v", err)
+	}
+	if err := c.UpdateHandle(h+1, 1, decimal.New(1, 0)); !errors.Is(err, ErrUnknownAsset) {
+		t.Errorf("handle out of range: %v", err)
+	}
+	if id, ok := c.Id(h); !ok || id != "GOOG" {
+		t.Errorf("Id(%d) = %q, %v", h, id, ok)
+	}
+}
+
+func TestCompactTrackerValidation(t *testing.T) {
+	c := CompactAssetPriceTracker(ValidationPolicy{MaxPrice: decimal.New(1000, 0)})
+	for _, tc := range []struct {
+		id    string
+		price float64
+	}{
+		{"AAPL", -1},
+		{"AAPL", 1001},
+		{"", 1},
+	} {
+		err := c.Update(1, tc.id, tc.price)
+		if !errors.Is(err, ErrInvalidInput) || err.Error() == ErrInvalidInput.Error() {
+			t.Errorf("Update(%q, %v): %v, want a detailed ErrInvalidInput", tc.id, tc.price, err)
+		}
+	}
+	h := c.Intern("AAPL")
+	if err := c.UpdateHandle(h, 1, decimal.New(-1, 0)); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("UpdateHandle with a negative price: %v", err)
+	}
+	if _, err := c.CurrentPriceHandle(h); !errors.Is(err, ErrNoPrice) {
+		t.Errorf("rejected updates were stored: %v", err)
+	}
+}
+
+// TestCompactTrackerConcurrent interns across several chunks while other
+// goroutines update and read; run it with -race.
+func TestCompactTrackerConcurrent(t *testing.T) {
+	c := CompactAssetPriceTracker(ValidationPolicy{})
+	const workers, perWorker = 8, 2 * compactChunkSize
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWorker {
+				id := fmt.Sprintf("W%dA%d", w, i)
+				if err := c.Update(i+1, id, float64(i+1)); err != nil {
+					t.Errorf("Update(%s): %v", id, err)
+					return
+				}
+				// the other worker may not have interned or priced it yet
+				_, err := c.GetCurrentPrice(fmt.Sprintf("W%dA%d", (w+1)%workers, i))
+				if err != nil && !errors.Is(err, ErrUnknownAsset) && !errors.Is(err, ErrNoPrice) {
+					t.Errorf("GetCurrentPrice: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for w := range workers {
+		for _, i := range []int{0, perWorker - 1} {
+			p, err := c.GetCurrentPrice(fmt.Sprintf("W%dA%d", w, i))
+			if err != nil || p.Timestamp != i+1 {
+				t.Errorf("W%dA%d: %v, %v", w, i, p, err)
+			}
+		}
+	}
+}
+
+// The memory benchmarks store a price for 1M assets and report the live
+// heap per asset, so the compact and full trackers can be compared.
+const memBenchAssets = 1 << 20
+
+func heapInUse() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+func BenchmarkMemoryCompact(b *testing.B) {
+	ids := benchIds(memBenchAssets)
+	for range b.N {
+		before := heapInUse()
+		c := CompactAssetPriceTracker(ValidationPolicy{})
+		for i, id := range ids {
+			c.Update(i+1, id, 100.25)
+		}
+		b.ReportMetric(float64(heapInUse()-before)/memBenchAssets, "B/asset")
+		runtime.KeepAlive(c)
+	}
+}
+
+func BenchmarkMemoryTracker(b *testing.B) {
+	ids := benchIds(memBenchAssets)
+	for range b.N {
+		before := heapInUse()
+		tr := AssetPriceTracker()
+		for i, id := range ids {
+			tr.Update(i+1, id, 100.25)
+		}
+		b.ReportMetric(float64(heapInUse()-before)/memBenchAssets, "B/asset")
+		runtime.KeepAlive(tr)
+	}
+}
+
+func BenchmarkCompactUpdateHandle(b *testing.B) {
+	c := CompactAssetPriceTracker(ValidationPolicy{})
+	handles := make([]Handle, 1024)
+	for i := range handles {
+		handles[i] = c.Intern(fmt.Sprintf("ASSET%d", i))
+	}
+	price := decimal.New(10025, 2)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			i++
+			c.UpdateHandle(handles[i%len(handles)], i, price)
+		}
+	})
+}
+
+func BenchmarkCompactCurrentPriceHandle(b *testing.B) {
+	c := CompactAssetPriceTracker(ValidationPolicy{})
+	handles := make([]Handle, 1024)
+	for i := range handles {
+		handles[i] = c.Intern(fmt.Sprintf("ASSET%d", i))
+		c.UpdateHandle(handles[i], 1, decimal.New(10025, 2))
+	}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			i++
+			c.CurrentPriceHandle(handles[i%len(handles)])
+		}
+	})
+}
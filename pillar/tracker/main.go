@@ -1,45 +1,276 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
 	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"errors"
+	"github.com/rasha-hantash/interviews/pillar/decimal"
 )
 
+// tracker is safe for concurrent use. Assets are spread over shards by id
+// so writers for different assets rarely contend on the same lock.
 type tracker struct {
-	companyTracker map[string]*Price // only for most current timestamp
-	// companyTracker map[string][]*Price // history
+	shards        []*shard
+	shardMask     uint32
+	latePolicy    LatePolicy
+	consolidation ConsolidationPolicy
+	validation    ValidationPolicy
+	maxAge        time.Duration
+	now           func() time.Time
+
+	candleIntervals []time.Duration
+	maxCandles      int
+	rollingWindow   int
+
+	alerts   alertRegistry
+	wal      wal
+	registry registry
+}
+
+// asset is everything the tracker keeps for a single company: the latest
+// price from each vendor, the consolidated current price, every update it
+// has seen and the consolidated price over time, ordered by timestamp.
+type asset struct {
+	current  *Price
+	vendors  map[string]*Price
+	history  history
+	timeline timeline
+	candles  []*candleSeries
+	rolling  *rolling
+	counts   UpdateCounts
 }
 
 type Price struct {
-	Price     float64
-	Timestamp int
+	Price     decimal.Decimal `json:"price"`
+	Timestamp int             `json:"timestamp"`
+	Vendor    string          `json:"vendor,omitempty"`
+	Qty       float64         `json:"qty,omitempty"`
+}
+
+// Tick is a single price update as delivered by a vendor. Updates that
+// don't care about the source leave Vendor empty, and Qty is only set
+// when the vendor reports traded quantity.
+type Tick struct {
+	Timestamp int             `json:"timestamp"`
+	CompanyId string          `json:"asset_id"`
+	Vendor    string          `json:"vendor,omitempty"`
+	Price     decimal.Decimal `json:"price"`
+	Qty       float64         `json:"qty,omitempty"`
+}
+
+// UnmarshalJSON requires timestamp and price, which would otherwise
+// silently decode to zero when a vendor leaves them out.
+func (t *Tick) UnmarshalJSON(data []byte) error {
+	type plain Tick
+	var wire struct {
+		plain
+		Timestamp *int             `json:"timestamp"`
+		Price     *decimal.Decimal `json:"price"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	switch {
+	case wire.Timestamp == nil:
+		return fmt.Errorf("%w: missing timestamp", ErrInvalidInput)
+	case wire.Price == nil:
+		return fmt.Errorf("%w: missing price", ErrInvalidInput)
+	}
+	*t = Tick(wire.plain)
+	t.Timestamp, t.Price = *wire.Timestamp, *wire.Price
+	return nil
 }
 
-func (t *tracker) Update(timestamp int, companyId string, price float64) {
-	// var price Price
-	t.companyTracker[companyId] = &Price{
-		Price:     price,
+// Update records a price for the company from the default vendor. The
+// float is converted to the shortest decimal that represents it.
+func (t *tracker) Update(timestamp int, companyId string, price float64) error {
+	d, err := decimal.FromFloat(price)
+	if err != nil {
+		return fmt.Errorf("%w: price %v for %s", ErrInvalidInput, price, companyId)
+	}
+	return t.Record(Tick{
 		Timestamp: timestamp,
+		CompanyId: companyId,
+		Price:     d,
+	})
+}
+
+// Record applies a tick. Prices of registered assets are stored rounded
+// to the asset's decimals, however they arrive. Ticks that fail
+// validation are rejected with an error wrapping ErrInvalidInput. Ticks
+// older than the vendor's latest price never replace it; depending on the
+// late policy they are either filed into history or rejected with
+// ErrLateUpdate.
+func (t *tracker) Record(tick Tick) error {
+	tick, err := t.prepare(tick)
+	if err != nil {
+		return err
+	}
+
+	s := t.shardFor(tick.CompanyId)
+	s.mu.Lock()
+
+	a := t.assetFor(s, tick.CompanyId)
+	prev := a.current
+	err = t.apply(a, tick)
+	if err == nil {
+		err = t.wal.append(tick)
+	}
+
+	var events []AlertEvent
+	if states := s.alerts[tick.CompanyId]; len(states) > 0 && a.current != prev {
+		events = evaluateAlerts(states, a, prev)
+	}
+	s.mu.Unlock()
+
+	deliverAlerts(events)
+	return err
+}
+
+// prepare rounds a tick's price to its asset's registered decimals and
+// validates it, before Record and RecordBatch take any lock. The write-ahead
+// log stores the prepared tick, so replaying it needs neither step.
+func (t *tracker) prepare(tick Tick) (Tick, error) {
+	if info, ok := t.assetInfo(tick.CompanyId); ok {
+		tick.Price = tick.Price.Rescale(info.Decimals)
+	}
+	return tick, t.validation.check(tick)
+}
+
+func (t *tracker) newAsset() *asset {
+	return &asset{
+		vendors: make(map[string]*Price),
+		candles: t.newCandleSeries(),
+		rolling: t.newRolling(),
+	}
+}
+
+// assetFor returns the company's asset, creating it if this is the first
+// update; the caller holds the shard's write lock.
+func (t *tracker) assetFor(s *shard, companyId string) *asset {
+	a, ok := s.assets[companyId]
+	if !ok {
+		a = t.newAsset()
+		s.assets[companyId] = a
+	}
+	return a
+}
+
+// apply does the work of Record; the caller holds the asset's shard lock.
+func (t *tracker) apply(a *asset, tick Tick) error {
+	p := Price{
+		Price:     tick.Price,
+		Timestamp: tick.Timestamp,
+		Vendor:    tick.Vendor,
+		Qty:       tick.Qty,
 	}
+
+	late, corrected := false, false
+	latest := a.vendors[tick.Vendor]
+	switch {
+	case latest == nil || p.Timestamp > latest.Timestamp:
+		a.vendors[tick.Vendor] = &p
+		a.current = t.consolidation.Consolidate(a.vendors)
+	case p.Timestamp == latest.Timestamp:
+		a.counts.Duplicate++
+		if p.Price.Equal(latest.Price) {
+			return nil
+		}
+		// same timestamp, different price: treat it as a correction
+		corrected = true
+		a.vendors[tick.Vendor] = &p
+		a.current = t.consolidation.Consolidate(a.vendors)
+	default:
+		late = true
+		a.counts.Late++
+		if t.latePolicy == RejectLate {
+			return ErrLateUpdate
+		}
+	}
+	a.counts.Accepted++
+	a.settle(t.consolidation, a.history.insert(p))
+	if a.rolling != nil && !late {
+		key := sampleKey{vendor: p.Vendor, timestamp: p.Timestamp}
+		if corrected {
+			a.rolling.correct(key, a.current.Price.Float64(), p.Price.Float64(), p.Qty)
+		} else {
+			a.rolling.add(key, a.current.Price.Float64(), p.Price.Float64(), p.Qty)
+		}
+	}
+	for _, c := range a.candles {
+		c.add(p, t.maxCandles)
+	}
+	return nil
 }
 
+// GetCurrentPrice returns the most recent price of the company. The
+// returned Price is shared and must not be modified. If the price is
+// older than the asset's maximum age a *StalePriceError is returned
+// instead.
 func (t *tracker) GetCurrentPrice(companyId string) (*Price, error) {
-	if price, ok := t.companyTracker[companyId]; ok {
-		return price, nil
+	s := t.shardFor(companyId)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if a, ok := s.assets[companyId]; ok {
+		if err := t.checkStale(s, companyId, a.current); err != nil {
+			return nil, err
+		}
+		return a.current, nil
 	}
-	// what to do if company does not exist
-	return nil, errors.New("company does not exist")
+	return nil, ErrUnknownAsset
 }
 
-func AssetPriceTracker() *tracker {
-	return &tracker{
-		companyTracker: make(map[string]*Price),
+type Option func(*tracker)
+
+func AssetPriceTracker(opts ...Option) *tracker {
+	t := &tracker{
+		consolidation: LatestWins{},
+		now:           time.Now,
+		alerts:        alertRegistry{owners: make(map[int]string)},
+		registry: registry{
+			assets:  make(map[string]AssetInfo),
+			fxPairs: make(map[[2]string]string),
+		},
+	}
+	WithShards(defaultShards)(t)
+	for _, opt := range opts {
+		opt(t)
 	}
+	return t
 }
 
 func main() {
-	tracker := AssetPriceTracker()
+	snapshotPath := flag.String("snapshot", "", "snapshot file to restore on startup and checkpoint to on exit")
+	walPath := flag.String("wal", "", "write-ahead log of updates since the last snapshot")
+	addr := flag.String("addr", "", "serve the HTTP price service on this address after the demo, e.g. :8082")
+	flag.Parse()
+
+	tracker := AssetPriceTracker(
+		WithCandles(0, time.Second, time.Minute, 5*time.Minute, time.Hour),
+	)
+	tracker.RegisterAsset("AAPL", AssetInfo{Currency: "USD", Decimals: 2})
+	tracker.RegisterAsset("GOOG", AssetInfo{Currency: "USD", Decimals: 2})
+	if err := tracker.Recover(*snapshotPath, *walPath); err != nil {
+		log.Fatal("recover: ", err)
+	}
+	defer tracker.CloseWAL()
+	if *snapshotPath != "" {
+		defer func() {
+			if err := tracker.Checkpoint(*snapshotPath); err != nil {
+				slog.Error("Error writing snapshot", "error", err.Error())
+			}
+		}()
+	}
+
 	tracker.Update(1627683600, "AAPL", 145.30)
 	price, err := tracker.GetCurrentPrice("AAPL")
 	if err != nil {
@@ -65,6 +296,26 @@ func main() {
 
 	slog.Info("GOOG", "current_price", price.Price) // Output: 2729.89
 
+	price, err = tracker.GetPriceAt("AAPL", 1627683659)
+	if err != nil {
+		slog.Error("Error getting price", "error", err.Error())
+	}
+
+	slog.Info("APPL", "price_at", price.Price) // Output: 145.30
+
+	tracker.Update(1627683630, "AAPL", 145.40) // late tick, filed into history only
+	counts, _ := tracker.UpdateCounts("AAPL")
+	slog.Info("APPL", "late_updates", counts.Late) // Output: 1
+
+	if *addr == "" {
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := newPriceServer(tracker).serve(ctx, *addr); err != nil {
+		slog.Error("Error serving", "error", err.Error())
+	}
+
 	// print(tracker.get_current_price("AAPL"))  # Output: 145.50
 	// print(tracker.get_current_price("GOOG"))  # Output: 2729.89
 
@@ -0,0 +1,40 @@
+package main
+
+// LatePolicy decides what happens to an update whose timestamp is older
+// than the latest price from the same vendor.
+type LatePolicy int
+
+const (
+	// FileLate keeps late updates in history (so GetPriceAt sees them)
+	// without touching the current price. This is the default.
+	FileLate LatePolicy = iota
+	// RejectLate drops late updates and returns ErrLateUpdate.
+	RejectLate
+)
+
+func WithLatePolicy(p LatePolicy) Option {
+	return func(t *tracker) {
+		t.latePolicy = p
+	}
+}
+
+// UpdateCounts reports how the updates seen for an asset were handled.
+// Late updates are counted even when they are rejected; duplicates are
+// updates carrying the same timestamp as the vendor's latest price.
+type UpdateCounts struct {
+	Accepted  int
+	Late      int
+	Duplicate int
+}
+
+func (t *tracker) UpdateCounts(companyId string) (UpdateCounts, error) {
+	s := t.shardFor(companyId)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.assets[companyId]
+	if !ok {
+		return UpdateCounts{}, ErrUnknownAsset
+	}
+	return a.counts, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+func TestLateAndDuplicateUpdates(t *testing.T) {
+	type update struct {
+		ts     int
+		vendor string
+		price  string
+	}
+	for _, tc := range []struct {
+		name    string
+		policy  LatePolicy
+		updates []update
+		errs    []error
+		current string
+		at      map[int]string // GetPriceAt results
+		counts  UpdateCounts
+	}{
+		{
+			name:    "in order",
+			updates: []update{{1, "", "10"}, {2, "", "11"}, {3, "", "12"}},
+			current: "12",
+			at:      map[int]string{1: "10", 2: "11", 5: "12"},
+			counts:  UpdateCounts{Accepted: 3},
+		},
+		{
+			name:    "late is filed",
+			policy:  FileLate,
+			updates: []update{{1, "", "10"}, {5, "", "15"}, {3, "", "13"}},
+			current: "15",
+			at:      map[int]string{2: "10", 3: "13", 4: "13", 5: "15"},
+			counts:  UpdateCounts{Accepted: 3, Late: 1},
+		},
+		{
+			name:    "late is rejected",
+			policy:  RejectLate,
+			updates: []update{{1, "", "10"}, {5, "", "15"}, {3, "", "13"}},
+			errs:    []error{nil, nil, ErrLateUpdate},
+			current: "15",
+			at:      map[int]string{3: "10", 5: "15"},
+			counts:  UpdateCounts{Accepted: 2, Late: 1},
+		},
+		{
+			name:    "duplicate is ignored",
+			updates: []update{{1, "", "10"}, {1, "", "10"}},
+			current: "10",
+			at:      map[int]string{1: "10"},
+			counts:  UpdateCounts{Accepted: 1, Duplicate: 1},
+		},
+		{
+			name:    "same timestamp corrects",
+			updates: []update{{1, "", "10"}, {2, "", "11"}, {2, "", "12"}},
+			current: "12",
+			at:      map[int]string{1: "10", 2: "12"},
+			counts:  UpdateCounts{Accepted: 3, Duplicate: 1},
+		},
+		{
+			name:    "correcting an older tick is late",
+			policy:  RejectLate,
+			updates: []update{{1, "", "10"}, {2, "", "11"}, {1, "", "9"}},
+			errs:    []error{nil, nil, ErrLateUpdate},
+			current: "11",
+			at:      map[int]string{1: "10"},
+			counts:  UpdateCounts{Accepted: 2, Late: 1},
+		},
+		{
+			name:    "lateness is per vendor",
+			policy:  RejectLate,
+			updates: []update{{5, "a", "15"}, {3, "b", "13"}},
+			current: "15",
+			at:      map[int]string{3: "13", 5: "15"},
+			counts:  UpdateCounts{Accepted: 2},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := AssetPriceTracker(WithLatePolicy(tc.policy))
+			for i, u := range tc.updates {
+				err := tr.Record(Tick{Timestamp: u.ts, CompanyId: "AAPL", Vendor: u.vendor, Price: decimal.MustParse(u.price)})
+				var want error
+				if i < len(tc.errs) {
+					want = tc.errs[i]
+				}
+				if !errors.Is(err, want) {
+					t.Fatalf("update %d: error %v, want %v", i, err, want)
+				}
+			}
+
+			p, err := tr.GetCurrentPrice("AAPL")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Price.String() != tc.current {
+				t.Errorf("current price %s, want %s", p.Price, tc.current)
+			}
+			for ts, want := range tc.at {
+				p, err := tr.GetPriceAt("AAPL", ts)
+				if err != nil {
+					t.Errorf("GetPriceAt(%d): %v", ts, err)
+				} else if p.Price.String() != want {
+					t.Errorf("GetPriceAt(%d) = %s, want %s", ts, p.Price, want)
+				}
+			}
+			counts, err := tr.UpdateCounts("AAPL")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counts != tc.counts {
+				t.Errorf("counts %+v, want %+v", counts, tc.counts)
+			}
+		})
+	}
+}
+
+func TestUpdateCountsUnknownAsset(t *testing.T) {
+	if _, err := AssetPriceTracker().UpdateCounts("AAPL"); !errors.Is(err, ErrUnknownAsset) {
+		t.Errorf("error %v, want ErrUnknownAsset", err)
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+// Snapshots store, per asset, its update counts and full history in the
+// order it arrived; the latest vendor prices, the timeline, candles and
+// rolling statistics are rebuilt by replaying it on restore, which files
+// late ticks as late again. Each history entry refers to its vendor by
+// index into a per-asset vendor table to keep the file small.
+const snapshotMagic = "PTSNAP1\n"
+
+// maxWALRecord bounds the payload length read from a log record. A tick
+// takes a few dozen bytes, so a longer one means the length is corrupt.
+const maxWALRecord = 64 << 10
+
+// wal is an append-only log of every tick accepted since the last
+// checkpoint. Records are written straight to the file, so they survive
+// the process crashing; Checkpoint is what fsyncs.
+//
+// Each record is a uvarint payload length, the payload, then a CRC-32 of
+// the payload. A torn record at the end of the file is ignored on replay
+// and cut off by Recover.
+type wal struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf []byte
+}
+
+// append logs ticks with a single write.
+func (w *wal) append(ticks ...Tick) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil || len(ticks) == 0 {
+		return nil
+	}
+
+	w.buf = w.buf[:0]
+	var payload []byte
+	for _, tick := range ticks {
+		payload = binary.AppendVarint(payload[:0], int64(tick.Timestamp))
+		payload = appendString(payload, tick.CompanyId)
+		payload = appendString(payload, tick.Vendor)
+		payload = appendDecimal(payload, tick.Price)
+		payload = binary.LittleEndian.AppendUint64(payload, math.Float64bits(tick.Qty))
+
+		w.buf = binary.AppendUvarint(w.buf, uint64(len(payload)))
+		w.buf = append(w.buf, payload...)
+		w.buf = binary.LittleEndian.AppendUint32(w.buf, crc32.ChecksumIEEE(payload))
+	}
+	_, err := w.f.Write(w.buf)
+	return err
+}
+
+// OpenWAL starts logging every accepted update to the file at path,
+// appending to it if it already exists.
+func (t *tracker) OpenWAL(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	t.wal.mu.Lock()
+	defer t.wal.mu.Unlock()
+	if t.wal.f != nil {
+		t.wal.f.Close()
+	}
+	t.wal.f = f
+	return nil
+}
+
+func (t *tracker) CloseWAL() error {
+	t.wal.mu.Lock()
+	defer t.wal.mu.Unlock()
+	if t.wal.f == nil {
+		return nil
+	}
+	err := t.wal.f.Close()
+	t.wal.f = nil
+	return err
+}
+
+// ReplayWAL applies every intact record in r and returns how many were
+// applied, and the offset just past the last of them; anything after it
+// is a torn write. Replayed updates don't trigger alerts or get logged
+// again.
+func (t *tracker) ReplayWAL(r io.Reader) (n int, end int64, err error) {
+	br := bufio.NewReader(r)
+	var header [binary.MaxVarintLen64]byte
+	var record []byte
+	for ; ; n++ {
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			// io.EOF is a clean end; anything else is a torn length
+			return n, end, nil
+		}
+		if size > maxWALRecord {
+			return n, end, fmt.Errorf("wal record %d: length %d exceeds %d", n, size, maxWALRecord)
+		}
+		record = slices.Grow(record[:0], int(size)+4)[:size+4]
+		if _, err := io.ReadFull(br, record); err != nil {
+			return n, end, nil
+		}
+		payload := record[:size]
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(record[size:]) {
+			return n, end, fmt.Errorf("wal record %d: checksum mismatch", n)
+		}
+		tick, err := decodeTick(payload)
+		if err != nil {
+			return n, end, fmt.Errorf("wal record %d: %w", n, err)
+		}
+
+		s := t.shardFor(tick.CompanyId)
+		s.mu.Lock()
+		t.apply(t.assetFor(s, tick.CompanyId), tick)
+		s.mu.Unlock()
+		end += int64(binary.PutUvarint(header[:], size)) + int64(size) + 4
+	}
+}
+
+func decodeTick(payload []byte) (Tick, error) {
+	d := decoder{buf: payload}
+	tick := Tick{
+		Timestamp: int(d.varint()),
+		CompanyId: d.string(),
+		Vendor:    d.string(),
+		Price:     d.decimal(),
+		Qty:       d.float(),
+	}
+	return tick, d.err
+}
+
+// Snapshot writes the state of every asset to w. All shards are held for
+// reading while it runs so the snapshot is a single point in time.
+func (t *tracker) Snapshot(w io.Writer) error {
+	for _, s := range t.shards {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	}
+	return t.writeSnapshot(w)
+}
+
+// Checkpoint atomically replaces the snapshot at path with the current
+// state and truncates the write-ahead log, since everything in it is now
+// part of the snapshot.
+func (t *tracker) Checkpoint(path string) error {
+	for _, s := range t.shards {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	bw := bufio.NewWriter(tmp)
+	if err := t.writeSnapshot(bw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	t.wal.mu.Lock()
+	defer t.wal.mu.Unlock()
+	if t.wal.f == nil {
+		return nil
+	}
+	return t.wal.f.Truncate(0)
+}
+
+func (t *tracker) writeSnapshot(w io.Writer) error {
+	buf := []byte(snapshotMagic)
+	for _, s := range t.shards {
+		for id, a := range s.assets {
+			buf = appendString(buf, id)
+			buf = binary.AppendUvarint(buf, uint64(a.counts.Accepted))
+			buf = binary.AppendUvarint(buf, uint64(a.counts.Late))
+			buf = binary.AppendUvarint(buf, uint64(a.counts.Duplicate))
+
+			vendors := make(map[string]uint64, len(a.vendors))
+			buf = binary.AppendUvarint(buf, uint64(len(a.vendors)))
+			for v := range a.vendors {
+				vendors[v] = uint64(len(vendors))
+				buf = appendString(buf, v)
+			}
+
+			buf = binary.AppendUvarint(buf, uint64(len(a.history)))
+			for _, i := range a.history.arrivals() {
+				p := &a.history[i].Price
+				buf = binary.AppendVarint(buf, int64(p.Timestamp))
+				buf = binary.AppendUvarint(buf, vendors[p.Vendor])
+				buf = appendDecimal(buf, p.Price)
+				buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(p.Qty))
+				if len(buf) > 64<<10 {
+					if _, err := w.Write(buf); err != nil {
+						return err
+					}
+					buf = buf[:0]
+				}
+			}
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// Restore loads a snapshot written by Snapshot or Checkpoint, replacing
+// any state the tracker already holds for the assets in it.
+func (t *tracker) Restore(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) < len(snapshotMagic) || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return errors.New("not a tracker snapshot")
+	}
+
+	d := decoder{buf: data[len(snapshotMagic):]}
+	for len(d.buf) > 0 && d.err == nil {
+		id := d.string()
+		counts := UpdateCounts{
+			Accepted:  int(d.uvarint()),
+			Late:      int(d.uvarint()),
+			Duplicate: int(d.uvarint()),
+		}
+		nv := d.uvarint()
+		if nv > uint64(len(d.buf)) {
+			d.err = errShortBuffer
+			break
+		}
+		vendors := make([]string, nv)
+		for i := range vendors {
+			vendors[i] = d.string()
+		}
+
+		a := t.newAsset()
+		n := d.uvarint()
+		for i := uint64(0); i < n && d.err == nil; i++ {
+			tick := Tick{CompanyId: id, Timestamp: int(d.varint())}
+			if v := d.uvarint(); v < uint64(len(vendors)) {
+				tick.Vendor = vendors[v]
+			}
+			tick.Price = d.decimal()
+			tick.Qty = d.float()
+			t.apply(a, tick)
+		}
+		a.counts = counts
+		if d.err != nil {
+			break
+		}
+
+		s := t.shardFor(id)
+		s.mu.Lock()
+		s.assets[id] = a
+		s.mu.Unlock()
+	}
+	if d.err != nil {
+		return fmt.Errorf("corrupt snapshot: %w", d.err)
+	}
+	return nil
+}
+
+// Recover restores the snapshot at snapshotPath and replays the log at
+// walPath on top of it, then keeps logging new updates to walPath.
+// Either path may be empty or name a file that doesn't exist yet.
+func (t *tracker) Recover(snapshotPath, walPath string) error {
+	if snapshotPath != "" {
+		if err := restoreFile(snapshotPath, t.Restore); err != nil {
+			return err
+		}
+	}
+	if walPath == "" {
+		return nil
+	}
+	var end int64
+	err := restoreFile(walPath, func(r io.Reader) (err error) {
+		_, end, err = t.ReplayWAL(r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// cut off a record torn by a crash, or the next replay would stop at
+	// it and miss everything logged after
+	if fi, err := os.Stat(walPath); err == nil && fi.Size() > end {
+		if err := os.Truncate(walPath, end); err != nil {
+			return err
+		}
+	}
+	return t.OpenWAL(walPath)
+}
+
+func restoreFile(path string, restore func(io.Reader) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return restore(f)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendDecimal(buf []byte, d decimal.Decimal) []byte {
+	buf = binary.AppendVarint(buf, d.Units())
+	return append(buf, byte(d.Scale()))
+}
+
+// decoder reads the primitives written by the append helpers above. The
+// first error sticks and every later read returns a zero value.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+var errShortBuffer = errors.New("unexpected end of data")
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errShortBuffer
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errShortBuffer
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if uint64(len(d.buf)) < n {
+		d.err = errShortBuffer
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *decoder) decimal() decimal.Decimal {
+	units := d.varint()
+	if d.err != nil {
+		return decimal.Decimal{}
+	}
+	if len(d.buf) < 1 {
+		d.err = errShortBuffer
+		return decimal.Decimal{}
+	}
+	scale := int(d.buf[0])
+	d.buf = d.buf[1:]
+	return decimal.New(units, scale)
+}
+
+func (d *decoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) < 8 {
+		d.err = errShortBuffer
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return v
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+func persistedTracker() *tracker {
+	return AssetPriceTracker(
+		WithConsolidation(Median{}),
+		WithCandles(0, time.Minute),
+		WithRollingWindow(10),
+	)
+}
+
+// describe renders everything the tracker derives for an asset, so two
+// trackers can be compared after a restore.
+func describe(t *testing.T, tr *tracker, id string) string {
+	t.Helper()
+	var b strings.Builder
+	cur, err := tr.GetCurrentPrice(id)
+	if err != nil {
+		t.Fatalf("GetCurrentPrice(%s): %v", id, err)
+	}
+	counts, _ := tr.UpdateCounts(id)
+	st, _ := tr.GetRollingStats(id)
+	candles, _ := tr.GetCandles(id, time.Minute, 0)
+	fmt.Fprintf(&b, "current %+v\ncounts %+v\nrolling %+v\n", *cur, counts, st)
+	for _, c := range candles {
+		fmt.Fprintf(&b, "candle %s\n", candleString(c))
+	}
+	for ts := range 200 {
+		if p, err := tr.GetPriceAt(id, ts); err == nil {
+			fmt.Fprintf(&b, "at %d: %+v\n", ts, *p)
+		}
+	}
+	return b.String()
+}
+
+func recordHistory(t *testing.T, tr *tracker) {
+	t.Helper()
+	for _, tick := range []Tick{
+		{Timestamp: 5, CompanyId: "X", Price: decimal.MustParse("10")},
+		{Timestamp: 3, CompanyId: "X", Price: decimal.MustParse("1000")}, // late
+		{Timestamp: 70, CompanyId: "X", Vendor: "b", Price: decimal.MustParse("12"), Qty: 2},
+		{Timestamp: 70, CompanyId: "X", Vendor: "b", Price: decimal.MustParse("12"), Qty: 2}, // duplicate
+		{Timestamp: 71, CompanyId: "X", Vendor: "c", Price: decimal.MustParse("13.5")},
+		{Timestamp: 71, CompanyId: "X", Vendor: "c", Price: decimal.MustParse("13.25")}, // correction
+		{Timestamp: 65, CompanyId: "X", Vendor: "c", Price: decimal.MustParse("20")},    // late
+		{Timestamp: 130, CompanyId: "Y", Price: decimal.MustParse("7")},
+	} {
+		if err := tr.Record(tick); err != nil {
+			t.Fatalf("Record(%+v): %v", tick, err)
+		}
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	tr := persistedTracker()
+	recordHistory(t, tr)
+	var buf bytes.Buffer
+	if err := tr.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := persistedTracker()
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"X", "Y"} {
+		if got, want := describe(t, restored, id), describe(t, tr, id); got != want {
+			t.Errorf("%s after restore:\n%s\nwant:\n%s", id, got, want)
+		}
+	}
+}
+
+// A late tick must stay out of the rolling window after a restore.
+func TestRestoreKeepsLateTicksLate(t *testing.T) {
+	tr := AssetPriceTracker(WithRollingWindow(10))
+	tr.Update(5, "X", 10)
+	tr.Update(3, "X", 1000)
+	var buf bytes.Buffer
+	if err := tr.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored := AssetPriceTracker(WithRollingWindow(10))
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	st, err := restored.GetRollingStats("X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Count != 1 || st.SMA != 10 {
+		t.Errorf("rolling stats after restore %+v, want SMA 10 over 1 tick", st)
+	}
+}
+
+func TestRestoreRejectsOtherFiles(t *testing.T) {
+	if err := AssetPriceTracker().Restore(strings.NewReader("not a snapshot")); err == nil {
+		t.Error("restored a file without the snapshot header")
+	}
+	if err := AssetPriceTracker().Restore(strings.NewReader(snapshotMagic + "\x05AA")); err == nil {
+		t.Error("restored a truncated snapshot")
+	}
+}
+
+// After a crash tears the last record, recovering must cut it off so the
+// records logged after it are replayed on the next start.
+func TestRecoverTruncatesTornRecord(t *testing.T) {
+	wal := filepath.Join(t.TempDir(), "tracker.wal")
+	tr := persistedTracker()
+	if err := tr.Recover("", wal); err != nil {
+		t.Fatal(err)
+	}
+	tr.Update(1, "X", 1)
+	tr.Update(2, "X", 2)
+	tr.CloseWAL()
+
+	f, err := os.OpenFile(wal, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{30, 1, 2, 3}) // a length, then part of the payload
+	f.Close()
+
+	second := persistedTracker()
+	if err := second.Recover("", wal); err != nil {
+		t.Fatalf("recovering a torn log: %v", err)
+	}
+	second.Update(3, "X", 3)
+	second.CloseWAL()
+
+	third := persistedTracker()
+	if err := third.Recover("", wal); err != nil {
+		t.Fatalf("recovering after the torn record: %v", err)
+	}
+	third.CloseWAL()
+	if got, want := describe(t, third, "X"), describe(t, second, "X"); got != want {
+		t.Errorf("after recovery:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestReplayWALCorruptLength(t *testing.T) {
+	for _, size := range []uint64{maxWALRecord + 1, 1 << 40, 1<<64 - 1} {
+		data := binary.AppendUvarint(nil, size)
+		data = append(data, make([]byte, 64)...)
+		n, end, err := AssetPriceTracker().ReplayWAL(bytes.NewReader(data))
+		if err == nil || n != 0 || end != 0 {
+			t.Errorf("length %d: replayed %d records to %d, error %v", size, n, end, err)
+		}
+	}
+}
+
+func TestReplayWALChecksumMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tracker.wal")
+	tr := AssetPriceTracker()
+	if err := tr.OpenWAL(path); err != nil {
+		t.Fatal(err)
+	}
+	tr.Update(1, "X", 1)
+	tr.Update(2, "X", 2)
+	tr.CloseWAL()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-5] ^= 0xff // last byte of the second payload
+
+	n, end, err := AssetPriceTracker().ReplayWAL(bytes.NewReader(data))
+	if err == nil || n != 1 || end != int64(len(data)/2) {
+		t.Errorf("replayed %d records to %d of %d, error %v", n, end, len(data), err)
+	}
+}
+
+// Checkpoint folds the log into the snapshot and empties it; recovering
+// from both must give back everything.
+func TestCheckpointThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	snap, wal := filepath.Join(dir, "tracker.snap"), filepath.Join(dir, "tracker.wal")
+
+	tr := persistedTracker()
+	if err := tr.Recover(snap, wal); err != nil {
+		t.Fatal(err)
+	}
+	recordHistory(t, tr)
+	if err := tr.Checkpoint(snap); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(wal); err != nil || fi.Size() != 0 {
+		t.Fatalf("log after checkpoint: %v, %v", fi, err)
+	}
+	tr.Update(80, "X", 14)
+	tr.Update(60, "X", 9) // late
+	tr.Update(131, "Y", 8)
+	tr.CloseWAL()
+
+	recovered := persistedTracker()
+	if err := recovered.Recover(snap, wal); err != nil {
+		t.Fatal(err)
+	}
+	recovered.CloseWAL()
+	for _, id := range []string{"X", "Y"} {
+		if got, want := describe(t, recovered, id), describe(t, tr, id); got != want {
+			t.Errorf("%s after recovery:\n%s\nwant:\n%s", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"math"
+)
+
+// RollingStats summarises the last Count consolidated prices of an asset.
+// VWAP weights the price each tick actually traded at, not the
+// consolidated one, by its quantity; it is only meaningful when ticks
+// carried a quantity. Volume is the total quantity in the window and VWAP
+// is zero when it is.
+type RollingStats struct {
+	Count  int
+	SMA    float64
+	EMA    float64
+	StdDev float64
+	VWAP   float64
+	Volume float64
+}
+
+// rolling keeps a fixed-size window of prices and quantities with running
+// sums so every statistic updates in O(1). The sums are rebuilt from the
+// window each time it wraps to stop floating point drift building up.
+type rolling struct {
+	prices    []float64 // consolidated price after each tick
+	notionals []float64 // the tick's own price times its quantity
+	qtys      []float64
+	keys      []sampleKey
+	next      int
+	full      bool
+	added     int
+
+	sum, sumSq    float64
+	notional, vol float64
+
+	alpha   float64
+	ema     float64
+	prevEma float64 // before the latest sample, so it can be corrected
+}
+
+// sampleKey identifies the tick a sample came from, so a correction can
+// find it.
+type sampleKey struct {
+	vendor    string
+	timestamp int
+}
+
+// WithRollingWindow keeps rolling statistics over the last n prices of
+// each asset. The EMA uses the usual 2/(n+1) smoothing factor.
+func WithRollingWindow(n int) Option {
+	return func(t *tracker) {
+		t.rollingWindow = n
+	}
+}
+
+func (t *tracker) newRolling() *rolling {
+	if t.rollingWindow <= 0 {
+		return nil
+	}
+	return &rolling{
+		prices:    make([]float64, t.rollingWindow),
+		notionals: make([]float64, t.rollingWindow),
+		qtys:      make([]float64, t.rollingWindow),
+		keys:      make([]sampleKey, t.rollingWindow),
+		alpha:     2 / float64(t.rollingWindow+1),
+	}
+}
+
+// add appends a sample: price is the consolidated price after the tick,
+// and traded and qty are the tick's own price and quantity.
+func (r *rolling) add(key sampleKey, price, traded, qty float64) {
+	if r.full {
+		r.drop(r.next)
+	}
+	r.set(r.next, key, price, traded*qty, qty)
+
+	r.next++
+	if r.next == len(r.prices) {
+		r.next = 0
+		r.full = true
+		r.resum()
+	}
+
+	r.prevEma = r.ema
+	if r.added++; r.added == 1 {
+		r.ema = price
+	} else {
+		r.ema += r.alpha * (price - r.ema)
+	}
+}
+
+// correct replaces the sample of a tick that has been corrected, if it is
+// still in the window. The EMA can only be redone when the corrected
+// sample is the latest one.
+func (r *rolling) correct(key sampleKey, price, traded, qty float64) {
+	n := r.next
+	if r.full {
+		n = len(r.prices)
+	}
+	for k := range n {
+		i := (r.next - 1 - k + len(r.prices)) % len(r.prices)
+		if r.keys[i] != key {
+			continue
+		}
+		r.drop(i)
+		r.set(i, key, price, traded*qty, qty)
+		if k == 0 {
+			if r.added == 1 {
+				r.ema = price
+			} else {
+				r.ema = r.prevEma + r.alpha*(price-r.prevEma)
+			}
+		}
+		return
+	}
+}
+
+func (r *rolling) set(i int, key sampleKey, price, notional, qty float64) {
+	r.keys[i] = key
+	r.prices[i], r.notionals[i], r.qtys[i] = price, notional, qty
+	r.sum += price
+	r.sumSq += price * price
+	r.notional += notional
+	r.vol += qty
+}
+
+func (r *rolling) drop(i int) {
+	old := r.prices[i]
+	r.sum -= old
+	r.sumSq -= old * old
+	r.notional -= r.notionals[i]
+	r.vol -= r.qtys[i]
+}
+
+func (r *rolling) resum() {
+	r.sum, r.sumSq, r.notional, r.vol = 0, 0, 0, 0
+	for i, p := range r.prices {
+		r.sum += p
+		r.sumSq += p * p
+		r.notional += r.notionals[i]
+		r.vol += r.qtys[i]
+	}
+}
+
+func (r *rolling) stats() RollingStats {
+	n := r.next
+	if r.full {
+		n = len(r.prices)
+	}
+	if n == 0 {
+		return RollingStats{}
+	}
+	mean := r.sum / float64(n)
+	// clamp: cancellation can push the variance slightly below zero
+	variance := max(r.sumSq/float64(n)-mean*mean, 0)
+	st := RollingStats{
+		Count:  n,
+		SMA:    mean,
+		EMA:    r.ema,
+		StdDev: math.Sqrt(variance),
+		Volume: r.vol,
+	}
+	if r.vol > 0 {
+		st.VWAP = r.notional / r.vol
+	}
+	return st
+}
+
+// GetRollingStats returns the rolling statistics for the company.
+func (t *tracker) GetRollingStats(companyId string) (RollingStats, error) {
+	s := t.shardFor(companyId)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.assets[companyId]
+	if !ok {
+		return RollingStats{}, ErrUnknownAsset
+	}
+	if a.rolling == nil {
+		return RollingStats{}, errors.New("rolling statistics not configured")
+	}
+	return a.rolling.stats(), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+func recordTick(t *testing.T, tr *tracker, ts int, vendor, price string, qty float64) {
+	t.Helper()
+	err := tr.Record(Tick{Timestamp: ts, CompanyId: "AAPL", Vendor: vendor, Price: decimal.MustParse(price), Qty: qty})
+	if err != nil {
+		t.Fatalf("Record(%d, %s, %s): %v", ts, vendor, price, err)
+	}
+}
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// Under Median the consolidated price is often one nobody traded at, so
+// VWAP must use each tick's own price.
+func TestRollingVWAPUsesTradedPrices(t *testing.T) {
+	tr := AssetPriceTracker(WithConsolidation(Median{}), WithRollingWindow(10))
+	recordTick(t, tr, 1, "a", "100", 1)
+	recordTick(t, tr, 2, "b", "110", 3) // median 105
+
+	st, err := tr.GetRollingStats("AAPL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (100*1 + 110*3) / 4.0; !closeTo(st.VWAP, want) {
+		t.Errorf("VWAP = %v, want %v", st.VWAP, want)
+	}
+	if want := (100 + 105) / 2.0; !closeTo(st.SMA, want) {
+		t.Errorf("SMA = %v, want %v", st.SMA, want)
+	}
+}
+
+func TestRollingCorrectionReplacesSample(t *testing.T) {
+	tr := AssetPriceTracker(WithRollingWindow(10))
+	recordTick(t, tr, 1, "a", "100", 1)
+	recordTick(t, tr, 2, "a", "200", 1)
+	recordTick(t, tr, 2, "a", "120", 2) // correction
+
+	st, err := tr.GetRollingStats("AAPL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RollingStats{
+		Count:  2,
+		SMA:    110,
+		EMA:    100 + 2.0/11*(120-100),
+		StdDev: 10,
+		VWAP:   (100 + 120*2) / 3.0,
+		Volume: 3,
+	}
+	if st.Count != want.Count || !closeTo(st.SMA, want.SMA) || !closeTo(st.EMA, want.EMA) ||
+		!closeTo(st.StdDev, want.StdDev) || !closeTo(st.VWAP, want.VWAP) || !closeTo(st.Volume, want.Volume) {
+		t.Errorf("stats = %+v, want %+v", st, want)
+	}
+}
+
+func TestRollingWindowWraps(t *testing.T) {
+	tr := AssetPriceTracker(WithRollingWindow(3))
+	for i, price := range []string{"1", "2", "3", "4", "5"} {
+		recordTick(t, tr, i+1, "", price, 1)
+	}
+	st, err := tr.GetRollingStats("AAPL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Count != 3 || !closeTo(st.SMA, 4) || !closeTo(st.VWAP, 4) || !closeTo(st.Volume, 3) {
+		t.Errorf("stats = %+v, want the last three ticks", st)
+	}
+}
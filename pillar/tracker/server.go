@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// priceServer exposes a tracker over HTTP with JSON bodies:
+//
+//	POST /prices                       ingest one Tick
+//	POST /prices/batch                 ingest a JSON array of Ticks, CSV or NDJSON
+//	GET  /prices?ids=AAPL,GOOG         current prices for several assets
+//	GET  /prices/{id}                  current price
+//	GET  /prices/{id}/at?timestamp=T   price in effect at T
+//	GET  /prices/{id}/candles?interval=1m&n=10
+type priceServer struct {
+	tracker *tracker
+
+	// Request bodies are capped so a client can't make the server buffer
+	// without limit.
+	maxTickBody  int64
+	maxBatchBody int64
+}
+
+// A tick is a few dozen bytes and a batch a vendor file.
+const (
+	defaultMaxTickBody  = 64 << 10
+	defaultMaxBatchBody = 32 << 20
+)
+
+func newPriceServer(t *tracker) *priceServer {
+	return &priceServer{
+		tracker:      t,
+		maxTickBody:  defaultMaxTickBody,
+		maxBatchBody: defaultMaxBatchBody,
+	}
+}
+
+func (ps *priceServer) routes() http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/prices", ps.ingest).Methods("POST")
+	router.HandleFunc("/prices/batch", ps.ingestBatch).Methods("POST")
+	router.HandleFunc("/prices", ps.getPrices).Methods("GET")
+	router.HandleFunc("/prices/{id}", ps.getPrice).Methods("GET")
+	router.HandleFunc("/prices/{id}/at", ps.getPriceAt).Methods("GET")
+	router.HandleFunc("/prices/{id}/candles", ps.getCandles).Methods("GET")
+	return router
+}
+
+type priceResponse struct {
+	AssetId string `json:"asset_id"`
+	*Price
+	Error string `json:"error,omitempty"`
+}
+
+func (ps *priceServer) ingest(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, ps.maxTickBody)
+	var tick Tick
+	if err := json.NewDecoder(r.Body).Decode(&tick); err != nil {
+		writeError(w, bodyStatus(err), err)
+		return
+	}
+	if err := ps.tracker.Record(tick); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// ingestBatch takes a JSON array of ticks by default, or a vendor file
+// when the request is sent as text/csv or application/x-ndjson. A file
+// over the size limit is refused with 413 once the limit is hit, by which
+// time the lines before it have been applied.
+func (ps *priceServer) ingestBatch(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, ps.maxBatchBody)
+	var result BatchResult
+	var err error
+	switch mediaType(r) {
+	case "text/csv":
+		result, err = ps.tracker.IngestCSV(r.Body)
+	case "application/x-ndjson":
+		result, err = ps.tracker.IngestNDJSON(r.Body)
+	default:
+		var ticks []Tick
+		if err = json.NewDecoder(r.Body).Decode(&ticks); err == nil {
+			result = ps.tracker.RecordBatch(ticks)
+		}
+	}
+	if err != nil {
+		writeError(w, bodyStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// bodyStatus is the status for a request body that couldn't be read.
+func bodyStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func mediaType(r *http.Request) string {
+	ct, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
+	return strings.TrimSpace(ct)
+}
+
+func (ps *priceServer) getPrices(w http.ResponseWriter, r *http.Request) {
+	ids := r.URL.Query().Get("ids")
+	if ids == "" {
+		writeError(w, http.StatusBadRequest, errors.New("ids parameter is required"))
+		return
+	}
+	results := ps.tracker.GetCurrentPrices(strings.Split(ids, ",")...)
+	resp := make([]priceResponse, len(results))
+	for i, res := range results {
+		resp[i] = priceResponse{AssetId: res.CompanyId, Price: res.Price}
+		if res.Err != nil {
+			resp[i].Error = res.Err.Error()
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (ps *priceServer) getPrice(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	price, err := ps.tracker.GetCurrentPrice(id)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, priceResponse{AssetId: id, Price: price})
+}
+
+func (ps *priceServer) getPriceAt(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	timestamp, err := strconv.Atoi(r.URL.Query().Get("timestamp"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("timestamp parameter must be an integer"))
+		return
+	}
+	price, err := ps.tracker.GetPriceAt(id, timestamp)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, priceResponse{AssetId: id, Price: price})
+}
+
+func (ps *priceServer) getCandles(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	interval, err := time.ParseDuration(r.URL.Query().Get("interval"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("interval parameter must be a duration such as 1m"))
+		return
+	}
+	n := 0
+	if v := r.URL.Query().Get("n"); v != "" {
+		if n, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("n parameter must be an integer"))
+			return
+		}
+	}
+	candles, err := ps.tracker.GetCandles(id, interval, n)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, candles)
+}
+
+// statusFor maps tracker errors onto HTTP status codes.
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnknownAsset), errors.Is(err, ErrNoPrice):
+		return http.StatusNotFound
+	case errors.Is(err, ErrLateUpdate), errors.Is(err, ErrStalePrice):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// serve runs the HTTP service until ctx is cancelled, then gives
+// in-flight requests a few seconds to finish.
+func (ps *priceServer) serve(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: ps.routes()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Starting price service", "addr", addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveRequest(t *testing.T, tr *tracker, method, path, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	newPriceServer(tr).routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIngestRequiresTimestampAndPrice(t *testing.T) {
+	for _, tc := range []struct {
+		body string
+		want int
+	}{
+		{`{"asset_id":"AAPL"}`, http.StatusBadRequest},
+		{`{"asset_id":"AAPL","price":1.5}`, http.StatusBadRequest},
+		{`{"asset_id":"AAPL","timestamp":10}`, http.StatusBadRequest},
+		{`{"asset_id":"AAPL","timestamp":0,"price":0}`, http.StatusCreated},
+		{`{"asset_id":"AAPL","timestamp":10,"price":"1.5"}`, http.StatusCreated},
+	} {
+		tr := AssetPriceTracker()
+		rec := serveRequest(t, tr, "POST", "/prices", "application/json", tc.body)
+		if rec.Code != tc.want {
+			t.Errorf("POST %s: status %d, want %d (%s)", tc.body, rec.Code, tc.want, rec.Body)
+		}
+		if _, err := tr.GetCurrentPrice("AAPL"); (err == nil) != (tc.want == http.StatusCreated) {
+			t.Errorf("POST %s: GetCurrentPrice error %v", tc.body, err)
+		}
+	}
+}
+
+func TestIngestBatchRequiresTimestampAndPrice(t *testing.T) {
+	tr := AssetPriceTracker()
+	rec := serveRequest(t, tr, "POST", "/prices/batch", "", `[{"asset_id":"AAPL","timestamp":1,"price":2},{"asset_id":"AAPL"}]`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("JSON batch: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	body := `{"asset_id":"AAPL","timestamp":1,"price":2}` + "\n" +
+		`{"asset_id":"AAPL","price":3}` + "\n" +
+		`{"asset_id":"AAPL","timestamp":3}` + "\n"
+	rec = serveRequest(t, tr, "POST", "/prices/batch", "application/x-ndjson", body)
+	var result BatchResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Accepted != 1 || result.Rejected != 2 || result.Errors[0].Index != 2 || result.Errors[1].Index != 3 {
+		t.Errorf("NDJSON batch: %+v", result)
+	}
+}
+
+func TestIngestLimitsBodySize(t *testing.T) {
+	tick := `{"asset_id":"AAPL","timestamp":1,"price":2}`
+	ps := newPriceServer(AssetPriceTracker())
+	ps.maxTickBody, ps.maxBatchBody = 256, 1024
+	for _, tc := range []struct {
+		path, contentType, body string
+	}{
+		{"/prices", "application/json", strings.Repeat(" ", 256) + tick},
+		{"/prices/batch", "", "[" + strings.Repeat(tick+",", 1024/len(tick)) + tick + "]"},
+		{"/prices/batch", "text/csv", strings.Repeat("1,AAPL,2\n", 1024/9+1)},
+		{"/prices/batch", "application/x-ndjson", strings.Repeat(tick+"\n", 1024/len(tick)+1)},
+	} {
+		req := httptest.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		rec := httptest.NewRecorder()
+		ps.routes().ServeHTTP(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("POST %s %s of %d bytes: status %d, want %d", tc.path, tc.contentType, len(tc.body), rec.Code, http.StatusRequestEntityTooLarge)
+		}
+	}
+
+	// the defaults take ordinary bodies
+	rec := serveRequest(t, AssetPriceTracker(), "POST", "/prices/batch", "", "["+strings.Repeat(tick+",", 1000)+tick+"]")
+	if rec.Code != http.StatusOK {
+		t.Errorf("batch of 1001 ticks: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultShards = 64
+
+// shard owns a slice of the asset id space. Readers take the read lock,
+// so GetCurrentPrice only waits on writers for assets in the same shard.
+type shard struct {
+	mu      sync.RWMutex
+	assets  map[string]*asset
+	maxAges map[string]time.Duration
+	alerts  map[string][]*alertState
+}
+
+// WithShards sets the number of lock stripes. n is rounded up to a power
+// of two so a shard can be picked with a mask instead of a modulo.
+func WithShards(n int) Option {
+	return func(t *tracker) {
+		size := 1
+		for size < n {
+			size <<= 1
+		}
+		t.shards = make([]*shard, size)
+		for i := range t.shards {
+			t.shards[i] = &shard{
+				assets:  make(map[string]*asset),
+				maxAges: make(map[string]time.Duration),
+				alerts:  make(map[string][]*alertState),
+			}
+		}
+		t.shardMask = uint32(size - 1)
+	}
+}
+
+func (t *tracker) shardFor(companyId string) *shard {
+	return t.shards[fnv32a(companyId)&t.shardMask]
+}
+
+// fnv32a hashes s without the []byte conversion hash/fnv would need.
+func fnv32a(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
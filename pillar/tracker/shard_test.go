@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestConcurrentWritersAndReaders is meant for go test -race: writers
+// share assets, readers poll them, and the final price of every asset must
+// be the one with the highest timestamp.
+func TestConcurrentWritersAndReaders(t *testing.T) {
+	const (
+		writers = 8
+		readers = 8
+		assets  = 32
+		updates = 500
+	)
+	tracker := AssetPriceTracker(WithShards(4))
+
+	var writing, reading sync.WaitGroup
+	for w := range writers {
+		writing.Add(1)
+		go func() {
+			defer writing.Done()
+			for i := range updates {
+				id := fmt.Sprintf("A%d", (w+i)%assets)
+				ts := i*writers + w + 1
+				if err := tracker.Update(ts, id, float64(ts)); err != nil {
+					t.Errorf("Update(%d, %s): %v", ts, id, err)
+				}
+			}
+		}()
+	}
+	stop := make(chan struct{})
+	var reads atomic.Int64
+	for r := range readers {
+		reading.Add(1)
+		go func() {
+			defer reading.Done()
+			for i := r; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				id := fmt.Sprintf("A%d", i%assets)
+				if p, err := tracker.GetCurrentPrice(id); err == nil && p.Price.Float64() != float64(p.Timestamp) {
+					t.Errorf("%s: price %s at timestamp %d", id, p.Price, p.Timestamp)
+				}
+				reads.Add(1)
+			}
+		}()
+	}
+
+	writing.Wait()
+	close(stop)
+	reading.Wait()
+
+	want := make(map[string]int)
+	for w := range writers {
+		for i := range updates {
+			id := fmt.Sprintf("A%d", (w+i)%assets)
+			want[id] = max(want[id], i*writers+w+1)
+		}
+	}
+	for id, ts := range want {
+		p, err := tracker.GetCurrentPrice(id)
+		if err != nil {
+			t.Fatalf("GetCurrentPrice(%s): %v", id, err)
+		}
+		if p.Timestamp != ts {
+			t.Errorf("%s: current timestamp %d, want %d", id, p.Timestamp, ts)
+		}
+	}
+	if reads.Load() == 0 {
+		t.Error("readers never ran")
+	}
+}
+
+func TestWithShardsRoundsUp(t *testing.T) {
+	for _, tc := range []struct{ n, want int }{{1, 1}, {3, 4}, {64, 64}, {100, 128}} {
+		if got := len(AssetPriceTracker(WithShards(tc.n)).shards); got != tc.want {
+			t.Errorf("WithShards(%d): %d shards, want %d", tc.n, got, tc.want)
+		}
+	}
+}
+
+var benchShards = []int{1, 16, 64, 256}
+
+func benchIds(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("ASSET%d", i)
+	}
+	return ids
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	ids := benchIds(1024)
+	for _, shards := range benchShards {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			tracker := AssetPriceTracker(WithShards(shards))
+			var ts atomic.Int64
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					n := int(ts.Add(1))
+					tracker.Update(n, ids[n%len(ids)], 100.25)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkGetCurrentPrice(b *testing.B) {
+	ids := benchIds(1024)
+	for _, shards := range benchShards {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			tracker := AssetPriceTracker(WithShards(shards))
+			for i, id := range ids {
+				tracker.Update(i+1, id, 100.25)
+			}
+			var next atomic.Int64
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					tracker.GetCurrentPrice(ids[int(next.Add(1))%len(ids)])
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// StalePriceError is returned by GetCurrentPrice when the latest price is
+// older than the maximum age configured for the asset. The stale price is
+// kept on the error for callers that still want to look at it.
+type StalePriceError struct {
+	CompanyId string
+	Price     Price
+	Age       time.Duration
+	MaxAge    time.Duration
+}
+
+func (e *StalePriceError) Error() string {
+	return fmt.Sprintf("price for %s is stale: age %s exceeds max age %s", e.CompanyId, e.Age, e.MaxAge)
+}
+
+func (e *StalePriceError) Is(target error) bool {
+	return target == ErrStalePrice
+}
+
+// WithMaxAge sets the default maximum age for every asset. Zero, the
+// default, means prices never go stale.
+func WithMaxAge(d time.Duration) Option {
+	return func(t *tracker) {
+		t.maxAge = d
+	}
+}
+
+// WithClock replaces the wall clock used to age prices.
+func WithClock(now func() time.Time) Option {
+	return func(t *tracker) {
+		t.now = now
+	}
+}
+
+// SetMaxAge overrides the maximum age for one asset. Passing zero removes
+// the override so the asset falls back to the tracker-wide default.
+func (t *tracker) SetMaxAge(companyId string, d time.Duration) {
+	s := t.shardFor(companyId)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d == 0 {
+		delete(s.maxAges, companyId)
+		return
+	}
+	s.maxAges[companyId] = d
+}
+
+// checkStale reports whether p is too old for the asset; the caller holds
+// the shard's lock.
+func (t *tracker) checkStale(s *shard, companyId string, p *Price) error {
+	maxAge, ok := s.maxAges[companyId]
+	if !ok {
+		maxAge = t.maxAge
+	}
+	if maxAge <= 0 {
+		return nil
+	}
+	age := t.now().Sub(time.Unix(int64(p.Timestamp), 0))
+	if age <= maxAge {
+		return nil
+	}
+	return &StalePriceError{
+		CompanyId: companyId,
+		Price:     *p,
+		Age:       age,
+		MaxAge:    maxAge,
+	}
+}
+
+// StaleAssets returns the ids of all assets whose current price has gone
+// stale, in sorted order.
+func (t *tracker) StaleAssets() []string {
+	var stale []string
+	for _, s := range t.shards {
+		s.mu.RLock()
+		for id, a := range s.assets {
+			if t.checkStale(s, id, a.current) != nil {
+				stale = append(stale, id)
+			}
+		}
+		s.mu.RUnlock()
+	}
+	sort.Strings(stale)
+	return stale
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStalePrices(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tr := AssetPriceTracker(WithMaxAge(time.Minute), WithClock(func() time.Time { return now }))
+	tr.Update(1000-60, "FRESH", 1) // exactly max age
+	tr.Update(1000-61, "OLD", 2)
+	tr.Update(1000-3600, "OVERRIDE", 3)
+	tr.Update(1000-3600, "ANCIENT", 4)
+	tr.SetMaxAge("OVERRIDE", 2*time.Hour)
+
+	for _, tc := range []struct {
+		id    string
+		stale bool
+	}{{"FRESH", false}, {"OLD", true}, {"OVERRIDE", false}, {"ANCIENT", true}} {
+		p, err := tr.GetCurrentPrice(tc.id)
+		if !tc.stale {
+			if err != nil {
+				t.Errorf("%s: %v", tc.id, err)
+			}
+			continue
+		}
+		var stale *StalePriceError
+		if !errors.As(err, &stale) || !errors.Is(err, ErrStalePrice) || p != nil {
+			t.Errorf("%s: got %v, %v, want a *StalePriceError", tc.id, p, err)
+			continue
+		}
+		if stale.CompanyId != tc.id || stale.MaxAge != time.Minute || stale.Age != now.Sub(time.Unix(int64(stale.Price.Timestamp), 0)) {
+			t.Errorf("%s: %+v", tc.id, stale)
+		}
+	}
+
+	if got := fmt.Sprint(tr.StaleAssets()); got != "[ANCIENT OLD]" {
+		t.Errorf("StaleAssets() = %s, want [ANCIENT OLD]", got)
+	}
+
+	// removing the override falls back to the default
+	tr.SetMaxAge("OVERRIDE", 0)
+	if got := fmt.Sprint(tr.StaleAssets()); got != "[ANCIENT OLD OVERRIDE]" {
+		t.Errorf("after removing the override, StaleAssets() = %s", got)
+	}
+}
+
+func TestPricesNeverStaleByDefault(t *testing.T) {
+	tr := AssetPriceTracker(WithClock(func() time.Time { return time.Unix(1<<40, 0) }))
+	tr.Update(1, "AAPL", 1)
+	if _, err := tr.GetCurrentPrice("AAPL"); err != nil {
+		t.Errorf("GetCurrentPrice: %v", err)
+	}
+	if stale := tr.StaleAssets(); len(stale) != 0 {
+		t.Errorf("StaleAssets() = %v", stale)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+// ConsolidationPolicy turns the latest price from each vendor into the
+// single price GetCurrentPrice reports. vendors is never empty and must
+// not be modified.
+type ConsolidationPolicy interface {
+	Consolidate(vendors map[string]*Price) *Price
+}
+
+func WithConsolidation(p ConsolidationPolicy) Option {
+	return func(t *tracker) {
+		t.consolidation = p
+	}
+}
+
+// LatestWins reports the most recent price from any vendor. Ties are
+// broken by vendor id so the result doesn't depend on map order.
+type LatestWins struct{}
+
+func (LatestWins) Consolidate(vendors map[string]*Price) *Price {
+	var best *Price
+	for _, p := range vendors {
+		if best == nil || p.Timestamp > best.Timestamp ||
+			(p.Timestamp == best.Timestamp && p.Vendor < best.Vendor) {
+			best = p
+		}
+	}
+	return best
+}
+
+// Median reports the median of the vendors' latest prices, stamped with
+// the newest of their timestamps. The result has no vendor.
+type Median struct{}
+
+func (Median) Consolidate(vendors map[string]*Price) *Price {
+	if len(vendors) == 1 {
+		for _, p := range vendors {
+			return p
+		}
+	}
+	prices := make([]decimal.Decimal, 0, len(vendors))
+	latest := 0
+	for _, p := range vendors {
+		prices = append(prices, p.Price)
+		if p.Timestamp > latest {
+			latest = p.Timestamp
+		}
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Cmp(prices[j]) < 0 })
+	mid := len(prices) / 2
+	median := prices[mid]
+	if len(prices)%2 == 0 {
+		// one more decimal place keeps the midpoint exact
+		sum := prices[mid-1].Add(median)
+		median, _ = sum.Div(decimal.New(2, 0), sum.Scale()+1)
+	}
+	return &Price{Price: median, Timestamp: latest}
+}
+
+// VendorPriority reports the price of the first vendor in Order that is
+// not stale. A vendor is stale once its latest price is more than
+// StaleAfter older than the newest price from any vendor; zero disables
+// the check. If every listed vendor is stale or missing, it falls back to
+// LatestWins.
+type VendorPriority struct {
+	Order      []string
+	StaleAfter int
+}
+
+func (v VendorPriority) Consolidate(vendors map[string]*Price) *Price {
+	newest := LatestWins{}.Consolidate(vendors)
+	for _, id := range v.Order {
+		p, ok := vendors[id]
+		if !ok {
+			continue
+		}
+		if v.StaleAfter > 0 && newest.Timestamp-p.Timestamp > v.StaleAfter {
+			continue
+		}
+		return p
+	}
+	return newest
+}
+
+// GetVendorPrice returns the latest price the given vendor reported for
+// the company.
+func (t *tracker) GetVendorPrice(companyId, vendor string) (*Price, error) {
+	s := t.shardFor(companyId)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.assets[companyId]
+	if !ok {
+		return nil, ErrUnknownAsset
+	}
+	p, ok := a.vendors[vendor]
+	if !ok {
+		return nil, fmt.Errorf("%w from vendor %q", ErrNoPrice, vendor)
+	}
+	return p, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+func vendorPrices(prices ...string) map[string]*Price {
+	vendors := make(map[string]*Price)
+	for i := 0; i < len(prices); i += 3 {
+		var ts int
+		fmt.Sscan(prices[i+1], &ts)
+		vendors[prices[i]] = &Price{Vendor: prices[i], Timestamp: ts, Price: decimal.MustParse(prices[i+2])}
+	}
+	return vendors
+}
+
+func TestConsolidationPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		policy  ConsolidationPolicy
+		vendors map[string]*Price
+		want    string // price@timestamp
+	}{
+		{"latest", LatestWins{}, vendorPrices("a", "1", "10", "b", "2", "20"), "20@2"},
+		{"latest tie", LatestWins{}, vendorPrices("b", "2", "20", "a", "2", "10"), "10@2"},
+		{"median of one", Median{}, vendorPrices("a", "1", "10"), "10@1"},
+		{"median odd", Median{}, vendorPrices("a", "1", "10", "b", "3", "30", "c", "2", "11"), "11@3"},
+		{"median even", Median{}, vendorPrices("a", "1", "10", "b", "2", "11"), "10.5@2"},
+		{"median even exact", Median{}, vendorPrices("a", "1", "1.01", "b", "2", "1.02"), "1.015@2"},
+		{"priority", VendorPriority{Order: []string{"a", "b"}}, vendorPrices("a", "1", "10", "b", "2", "20"), "10@1"},
+		{"priority missing", VendorPriority{Order: []string{"x", "b"}}, vendorPrices("a", "3", "10", "b", "2", "20"), "20@2"},
+		{"priority stale", VendorPriority{Order: []string{"a", "b"}, StaleAfter: 5}, vendorPrices("a", "1", "10", "b", "2", "20", "c", "10", "30"), "30@10"},
+		{"priority fresh enough", VendorPriority{Order: []string{"a"}, StaleAfter: 5}, vendorPrices("a", "5", "10", "c", "10", "30"), "10@5"},
+	} {
+		p := tc.policy.Consolidate(tc.vendors)
+		if got := fmt.Sprintf("%s@%d", p.Price, p.Timestamp); got != tc.want {
+			t.Errorf("%s: %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+// GetPriceAt must report the consolidated price, not whichever vendor
+// ticked last.
+func TestGetPriceAtIsConsolidated(t *testing.T) {
+	tr := AssetPriceTracker(WithConsolidation(VendorPriority{Order: []string{"a", "b"}}))
+	recordTick(t, tr, 1, "a", "100", 0)
+	recordTick(t, tr, 2, "b", "200", 0)
+
+	cur, err := tr.GetCurrentPrice("AAPL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at, err := tr.GetPriceAt("AAPL", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cur.Price.Equal(decimal.MustParse("100")) || *at != *cur {
+		t.Errorf("current %+v, at 2 %+v, want both a's 100", cur, at)
+	}
+}
+
+// Ticks arriving in any order must leave GetPriceAt as if they had been
+// consolidated in timestamp order, and agree with GetCurrentPrice.
+func TestTimelineMatchesTimestampOrder(t *testing.T) {
+	policies := []ConsolidationPolicy{
+		LatestWins{},
+		Median{},
+		VendorPriority{Order: []string{"a", "b", "c"}, StaleAfter: 4},
+	}
+	for _, policy := range policies {
+		rng := rand.New(rand.NewSource(1))
+		for round := range 50 {
+			tr := AssetPriceTracker(WithConsolidation(policy))
+			var ticks []Price
+			for range 30 {
+				p := Price{
+					Vendor:    string(rune('a' + rng.Intn(3))),
+					Timestamp: rng.Intn(20),
+					Price:     decimal.New(int64(rng.Intn(50)+1), 0),
+				}
+				ticks = append(ticks, p)
+				recordTick(t, tr, p.Timestamp, p.Vendor, p.Price.String(), 0)
+			}
+
+			// replay in timestamp order, keeping arrival order for ties
+			slices.SortStableFunc(ticks, func(x, y Price) int { return x.Timestamp - y.Timestamp })
+			vendors := make(map[string]*Price)
+			for i := range ticks {
+				vendors[ticks[i].Vendor] = &ticks[i]
+				if i+1 < len(ticks) && ticks[i+1].Timestamp == ticks[i].Timestamp {
+					continue
+				}
+				ts := ticks[i].Timestamp
+				want := policy.Consolidate(vendors)
+				got, err := tr.GetPriceAt("AAPL", ts)
+				if err != nil {
+					t.Fatalf("%T round %d: GetPriceAt(%d): %v", policy, round, ts, err)
+				}
+				if !got.Price.Equal(want.Price) || got.Timestamp != want.Timestamp {
+					t.Fatalf("%T round %d: GetPriceAt(%d) = %s@%d, want %s@%d",
+						policy, round, ts, got.Price, got.Timestamp, want.Price, want.Timestamp)
+				}
+			}
+			cur, _ := tr.GetCurrentPrice("AAPL")
+			last, _ := tr.GetPriceAt("AAPL", 1<<30)
+			if !cur.Price.Equal(last.Price) || cur.Timestamp != last.Timestamp {
+				t.Fatalf("%T round %d: current %+v but latest point %+v", policy, round, cur, last)
+			}
+		}
+	}
+}
+
+// Move alerts measure from the consolidated price, so a vendor that
+// isn't being reported can't trigger one.
+func TestMoveAlertUsesConsolidatedPrice(t *testing.T) {
+	var events []AlertEvent
+	tr := AssetPriceTracker(WithConsolidation(VendorPriority{Order: []string{"a", "b"}}))
+	_, err := tr.AddAlert(Alert{
+		CompanyId: "AAPL", Kind: Move, Percent: 10, Window: 5 * time.Second,
+		Func: func(ev AlertEvent) { events = append(events, ev) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordTick(t, tr, 1, "a", "100", 0)
+	recordTick(t, tr, 2, "b", "50", 0)
+	recordTick(t, tr, 7, "a", "105", 0)
+	if len(events) != 0 {
+		t.Fatalf("move from b's price fired: %+v", events)
+	}
+	recordTick(t, tr, 8, "a", "115", 0)
+	if len(events) != 1 || !events[0].Reference.Equal(decimal.MustParse("100")) {
+		t.Errorf("events %+v, want one measured from 100", events)
+	}
+}
@@ -8,47 +8,49 @@ import (
 	// "strconv"
 	"log/slog"
 	"sync"
+	"time"
 
 	"net/http"
 
 	"github.com/gorilla/websocket"
+	"github.com/rasha-hantash/interviews/pillar/decimal"
 )
 
 type TickerData struct {
-	EventTime       int64   `json:"event_time"`
-	Symbol          string  `json:"symbol"`
-	Price           float64 `json:"price"`
-	PriceChange     float64 `json:"price_change"`
-	PriceChangePercent float64 `json:"price_change_percent"`
-	WeightedAvgPrice float64 `json:"weighted_avg_price"`
-	PrevClosePrice  float64 `json:"prev_close_price"`
-	LastQty         float64 `json:"last_qty"`
-	BidPrice        float64 `json:"bid_price"`
-	AskPrice        float64 `json:"ask_price"`
-	OpenPrice       float64 `json:"open_price"`
-	HighPrice       float64 `json:"high_price"`
-	LowPrice        float64 `json:"low_price"`
-	Volume          float64 `json:"volume"`
-	QuoteVolume     float64 `json:"quote_volume"`
-	OpenTime        int64   `json:"open_time"`
-	CloseTime       int64   `json:"close_time"`
-	FirstId         int64   `json:"first_id"`
-	LastId          int64   `json:"last_id"`
-	Count           int64   `json:"count"`
+	EventTime          int64           `json:"event_time"`
+	Symbol             string          `json:"symbol"`
+	Price              decimal.Decimal `json:"price"`
+	PriceChange        decimal.Decimal `json:"price_change"`
+	PriceChangePercent decimal.Decimal `json:"price_change_percent"`
+	WeightedAvgPrice   decimal.Decimal `json:"weighted_avg_price"`
+	PrevClosePrice     decimal.Decimal `json:"prev_close_price"`
+	LastQty            float64         `json:"last_qty"`
+	BidPrice           decimal.Decimal `json:"bid_price"`
+	AskPrice           decimal.Decimal `json:"ask_price"`
+	OpenPrice          decimal.Decimal `json:"open_price"`
+	HighPrice          decimal.Decimal `json:"high_price"`
+	LowPrice           decimal.Decimal `json:"low_price"`
+	Volume             float64         `json:"volume"`
+	QuoteVolume        float64         `json:"quote_volume"`
+	OpenTime           int64           `json:"open_time"`
+	CloseTime          int64           `json:"close_time"`
+	FirstId            int64           `json:"first_id"`
+	LastId             int64           `json:"last_id"`
+	Count              int64           `json:"count"`
 }
 
-/* 
+/*
 
-PriceChange: The absolute price change (float64).
-PriceChangePercent: The percentage of price change (float64).
-WeightedAvgPrice: The weighted average price (float64).
-PrevClosePrice: The closing price of the previous period (float64).
+PriceChange: The absolute price change (decimal).
+PriceChangePercent: The percentage of price change (decimal).
+WeightedAvgPrice: The weighted average price (decimal).
+PrevClosePrice: The closing price of the previous period (decimal).
 LastQty: The quantity of the last trade (float64).
-BidPrice: The current highest bid price (float64).
-AskPrice: The current lowest ask price (float64).
-OpenPrice: The opening price of the current period (float64).
-HighPrice: The highest price of the current period (float64).
-LowPrice: The lowest price of the current period (float64).
+BidPrice: The current highest bid price (decimal).
+AskPrice: The current lowest ask price (decimal).
+OpenPrice: The opening price of the current period (decimal).
+HighPrice: The highest price of the current period (decimal).
+LowPrice: The lowest price of the current period (decimal).
 Volume: The trading volume in the base asset (float64).
 QuoteVolume: The trading volume in the quote asset (float64).
 OpenTime: The opening time of the current period (int64).
@@ -59,12 +61,29 @@ Count: The number of trades in the period (int64).
 
 */
 
+// streamMessage is either market data for a stream or, when Stream is
+// empty, the server's reply to a request.
+type streamMessage struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+	Id     int64           `json:"id"`
+	Error  *struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	} `json:"error"`
+}
+
 // todo: run goroutine tests (like gorace) to check for data races
 
+// readTimeout is how long to wait for any message before deciding the
+// server is gone. The server sends a heartbeat every few seconds even when
+// no data is flowing, and gorilla answers its pings while we read.
+const readTimeout = 30 * time.Second
+
 type LastPrice struct {
-	Symbol    string `json:"symbol"`
-	Price     float64 `json:"price"`
-	EventTime int64  `json:"event_time"`
+	Symbol    string          `json:"symbol"`
+	Price     decimal.Decimal `json:"price"`
+	EventTime int64           `json:"event_time"`
 }
 
 var (
@@ -89,6 +108,12 @@ func main() {
 	}
 	defer c.Close()
 
+	// the server only sends the streams we subscribe to
+	err = c.WriteJSON(map[string]any{"id": 1, "method": "subscribe", "params": []string{"*@ticker"}})
+	if err != nil {
+		log.Fatal("subscribe:", err)
+	}
+
 	go processMessage(c)
 	go processLatestPrice()
 
@@ -106,20 +131,36 @@ func processMessage(c *websocket.Conn) {
 			slog.Info("Stopping message processing")
 			return
 		default:
+			c.SetReadDeadline(time.Now().Add(readTimeout))
 			_, message, err := c.ReadMessage()
 			if err != nil {
 				log.Println("read:", err)
 				return
 			}
-			
 
-			var tickerData TickerData
-			err = json.Unmarshal(message, &tickerData)
+			var envelope streamMessage
+			err = json.Unmarshal(message, &envelope)
 			if err != nil {
 				log.Println("unmarshal:", err)
 				continue
 			}
+			if envelope.Stream == "" {
+				// a reply to one of our requests
+				if envelope.Error != nil {
+					slog.Error("Request failed", "id", envelope.Id, "error", envelope.Error.Msg)
+				}
+				continue
+			}
+			if envelope.Stream == "heartbeat" {
+				continue
+			}
 
+			var tickerData TickerData
+			err = json.Unmarshal(envelope.Data, &tickerData)
+			if err != nil {
+				log.Println("unmarshal:", err)
+				continue
+			}
 
 			lastPriceMsg := LastPrice{
 				Symbol:    tickerData.Symbol,
@@ -178,7 +219,7 @@ func GetLatestPrice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	slog.Info("Latest price update - Symbol: %s, Price: %s, EventTime: %d\n",)
+	slog.Info("Latest price update - Symbol: %s, Price: %s, EventTime: %d\n")
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(price)
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+// bookDepth is how many price levels each side of a simulated book holds.
+const bookDepth = 20
+
+// BookData is a message on a SYMBOL@book stream. Subscribing sends a
+// "snapshot" of the whole book, followed by "update" messages listing only
+// the levels that changed; a level with zero quantity has been removed.
+//
+// Sequence numbers count updates per symbol. Each update carries the
+// sequence of the one before it, so a client can apply updates on top of
+// a snapshot and spot a gap: updates with Sequence at or below the
+// snapshot's are already reflected in it and should be skipped, and an
+// update whose PrevSequence isn't the last one applied means messages were
+// dropped and the client should resubscribe for a fresh snapshot.
+type BookData struct {
+	Type         string      `json:"type"`
+	EventTime    int64       `json:"event_time"`
+	Symbol       string      `json:"symbol"`
+	Sequence     int64       `json:"sequence"`
+	PrevSequence int64       `json:"prev_sequence,omitempty"`
+	Bids         []BookLevel `json:"bids"`
+	Asks         []BookLevel `json:"asks"`
+}
+
+type BookLevel struct {
+	Price decimal.Decimal `json:"price"`
+	Qty   float64         `json:"qty"`
+}
+
+const (
+	bookSnapshot = "snapshot"
+	bookUpdate   = "update"
+)
+
+// orderBook holds the resting quantity at each of a symbol's price
+// levels. Levels sit one price increment apart, running away from the
+// symbol's quoted bid and ask, so the top of the book always matches the
+// ticker.
+type orderBook struct {
+	bids     map[decimal.Decimal]float64
+	asks     map[decimal.Decimal]float64
+	sequence int64
+	updated  time.Time
+}
+
+func newOrderBook(now time.Time) *orderBook {
+	return &orderBook{
+		updated: now,
+		bids:    make(map[decimal.Decimal]float64),
+		asks:    make(map[decimal.Decimal]float64),
+	}
+}
+
+// updateBook moves the book to the current quote after a trade and
+// returns the update, or false if nothing changed. The trade takes
+// liquidity from the level it executed at and a few other levels are
+// refreshed at random, as resting orders come and go.
+func (s *symbolState) updateBook(now time.Time) (BookData, bool) {
+	increment := decimal.New(1, s.cfg.Decimals)
+	bids := s.bookSide(s.book.bids, s.bid, increment.Neg())
+	asks := s.bookSide(s.book.asks, s.ask, increment)
+
+	side := bids
+	if s.price.Equal(s.ask) {
+		side = asks
+	}
+	if qty, ok := side[s.price]; ok {
+		if qty -= s.lastQty; qty > 0 {
+			side[s.price] = qty
+		} else {
+			side[s.price] = s.levelQty() // Refilled once the level is taken
+		}
+	}
+
+	update := BookData{
+		Type:      bookUpdate,
+		EventTime: now.UnixMilli(),
+		Symbol:    s.cfg.Symbol,
+		Bids:      diffLevels(s.book.bids, bids),
+		Asks:      diffLevels(s.book.asks, asks),
+	}
+	s.book.bids, s.book.asks = bids, asks
+	if len(update.Bids) == 0 && len(update.Asks) == 0 {
+		return BookData{}, false
+	}
+	sortLevels(update.Bids, true)
+	sortLevels(update.Asks, false)
+	update.PrevSequence = s.book.sequence
+	s.book.sequence++
+	s.book.updated = now
+	update.Sequence = s.book.sequence
+	return update, true
+}
+
+// bookSide lays out bookDepth levels from best, one step apart, keeping
+// the quantity of levels that were already in the book.
+func (s *symbolState) bookSide(old map[decimal.Decimal]float64, best, step decimal.Decimal) map[decimal.Decimal]float64 {
+	side := make(map[decimal.Decimal]float64, bookDepth)
+	price := best
+	for range bookDepth {
+		qty, ok := old[price]
+		if !ok || s.rng.Float64() < 0.1 {
+			qty = s.levelQty()
+		}
+		side[price] = qty
+		price = price.Add(step)
+		if price.Sign() <= 0 {
+			break
+		}
+	}
+	return side
+}
+
+// levelQty draws the resting quantity for one level, a couple of average
+// trades' worth.
+func (s *symbolState) levelQty() float64 {
+	return (0.5 + s.rng.ExpFloat64()*2) * s.cfg.TradeSize / s.mid
+}
+
+// diffLevels lists the levels that differ between two versions of one
+// side of the book.
+func diffLevels(old, cur map[decimal.Decimal]float64) []BookLevel {
+	var levels []BookLevel
+	for price, qty := range cur {
+		if old[price] != qty {
+			levels = append(levels, BookLevel{Price: price, Qty: qty})
+		}
+	}
+	for price := range old {
+		if _, ok := cur[price]; !ok {
+			levels = append(levels, BookLevel{Price: price})
+		}
+	}
+	return levels
+}
+
+// snapshot returns the whole book as of its latest update.
+func (s *symbolState) snapshot() BookData {
+	data := BookData{
+		Type:      bookSnapshot,
+		EventTime: s.book.updated.UnixMilli(),
+		Symbol:    s.cfg.Symbol,
+		Sequence:  s.book.sequence,
+		Bids:      make([]BookLevel, 0, len(s.book.bids)),
+		Asks:      make([]BookLevel, 0, len(s.book.asks)),
+	}
+	for price, qty := range s.book.bids {
+		data.Bids = append(data.Bids, BookLevel{Price: price, Qty: qty})
+	}
+	for price, qty := range s.book.asks {
+		data.Asks = append(data.Asks, BookLevel{Price: price, Qty: qty})
+	}
+	sortLevels(data.Bids, true)
+	sortLevels(data.Asks, false)
+	return data
+}
+
+// sortLevels orders levels best first: highest bids, lowest asks.
+func sortLevels(levels []BookLevel, descending bool) {
+	sort.Slice(levels, func(i, j int) bool {
+		if descending {
+			return levels[i].Price.Cmp(levels[j].Price) > 0
+		}
+		return levels[i].Price.Cmp(levels[j].Price) < 0
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+// localBook is a client's copy of one symbol's book, built the way
+// BookData describes: a snapshot, then the updates after it.
+type localBook struct {
+	sequence   int64
+	bids, asks map[decimal.Decimal]float64
+}
+
+func newLocalBook(snap BookData) *localBook {
+	b := &localBook{
+		sequence: snap.Sequence,
+		bids:     make(map[decimal.Decimal]float64),
+		asks:     make(map[decimal.Decimal]float64),
+	}
+	for _, l := range snap.Bids {
+		b.bids[l.Price] = l.Qty
+	}
+	for _, l := range snap.Asks {
+		b.asks[l.Price] = l.Qty
+	}
+	return b
+}
+
+// apply reports whether the update was used; it fails on a gap.
+func (b *localBook) apply(u BookData) (bool, error) {
+	if u.Sequence <= b.sequence {
+		return false, nil
+	}
+	if u.PrevSequence != b.sequence {
+		return false, fmt.Errorf("update %d follows %d, but the book is at %d", u.Sequence, u.PrevSequence, b.sequence)
+	}
+	for _, side := range []struct {
+		levels []BookLevel
+		book   map[decimal.Decimal]float64
+	}{{u.Bids, b.bids}, {u.Asks, b.asks}} {
+		for _, l := range side.levels {
+			if l.Qty == 0 {
+				delete(side.book, l.Price)
+			} else {
+				side.book[l.Price] = l.Qty
+			}
+		}
+	}
+	b.sequence = u.Sequence
+	return true, nil
+}
+
+func (b *localBook) String() string {
+	snap := BookData{Sequence: b.sequence}
+	for price, qty := range b.bids {
+		snap.Bids = append(snap.Bids, BookLevel{Price: price, Qty: qty})
+	}
+	for price, qty := range b.asks {
+		snap.Asks = append(snap.Asks, BookLevel{Price: price, Qty: qty})
+	}
+	sortLevels(snap.Bids, true)
+	sortLevels(snap.Asks, false)
+	return fmt.Sprint(snap.Sequence, snap.Bids, snap.Asks)
+}
+
+func snapshotString(snap BookData) string {
+	return fmt.Sprint(snap.Sequence, snap.Bids, snap.Asks)
+}
+
+// A snapshot plus the updates published after it must rebuild the book
+// exactly, and updates the snapshot already covers must be recognisable.
+func TestBookSnapshotPlusUpdates(t *testing.T) {
+	m := newMarket(defaultSymbols, 0, 0.8, 7, simEpoch)
+	clock := &simClock{t: simEpoch}
+	load := loadProfile{Kind: steady, Rate: 100}
+	symbol := defaultSymbols[0].Symbol
+
+	var updates []BookData
+	var snap BookData
+	lastSeq := int64(0)
+	for i := range 3000 {
+		if i == 1000 {
+			snap = m.bookSnapshots(symbol)[0]
+		}
+		ev := m.next(clock.advance(load))
+		if !ev.hasBook || ev.book.Symbol != symbol {
+			continue
+		}
+		u := ev.book
+		if u.Type != bookUpdate || u.Sequence != lastSeq+1 || u.PrevSequence != lastSeq {
+			t.Fatalf("update %+v after sequence %d", u, lastSeq)
+		}
+		for _, levels := range [][]BookLevel{u.Bids, u.Asks} {
+			for _, l := range levels {
+				if l.Qty < 0 {
+					t.Fatalf("update %d: negative quantity at %s", u.Sequence, l.Price)
+				}
+			}
+		}
+		lastSeq = u.Sequence
+		updates = append(updates, u)
+	}
+	if snap.Sequence == 0 || snap.Sequence >= lastSeq {
+		t.Fatalf("snapshot at %d of %d updates doesn't split them", snap.Sequence, lastSeq)
+	}
+
+	book := newLocalBook(snap)
+	skipped := 0
+	for _, u := range updates {
+		used, err := book.apply(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !used {
+			skipped++
+		}
+	}
+	if skipped != int(snap.Sequence) {
+		t.Errorf("skipped %d updates, want the %d before the snapshot", skipped, snap.Sequence)
+	}
+
+	final := m.bookSnapshots(symbol)[0]
+	if final.Type != bookSnapshot || final.Sequence != lastSeq {
+		t.Errorf("final snapshot %s at %d, want a snapshot at %d", final.Type, final.Sequence, lastSeq)
+	}
+	if got, want := book.String(), snapshotString(final); got != want {
+		t.Errorf("rebuilt book\n%s\nwant\n%s", got, want)
+	}
+}
+
+// The top of the book is the ticker's quote, and a missed update is
+// caught by its PrevSequence.
+func TestBookMatchesQuoteAndDetectsGaps(t *testing.T) {
+	m := newMarket(defaultSymbols[:1], 0, 0.8, 3, simEpoch)
+	now := simEpoch
+	book := newLocalBook(m.bookSnapshots("*")[0])
+	dropped := false
+	for range 500 {
+		now = now.Add(time.Second)
+		ev := m.next(now)
+		snap := m.bookSnapshots("*")[0]
+		if !snap.Bids[0].Price.Equal(ev.ticker.BidPrice) || !snap.Asks[0].Price.Equal(ev.ticker.AskPrice) {
+			t.Fatalf("top of book %s/%s, ticker quote %s/%s",
+				snap.Bids[0].Price, snap.Asks[0].Price, ev.ticker.BidPrice, ev.ticker.AskPrice)
+		}
+		if !ev.hasBook {
+			continue
+		}
+		if !dropped && ev.book.Sequence == 10 {
+			dropped = true // lose one update
+			continue
+		}
+		if _, err := book.apply(ev.book); err != nil {
+			if ev.book.Sequence != 11 {
+				t.Errorf("gap reported at %d, want 11: %v", ev.book.Sequence, err)
+			}
+			return
+		}
+	}
+	t.Error("a dropped update went unnoticed")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// connConfig sets how the server keeps track of whether a client is
+// still there.
+//
+// The server pings every PingInterval and drops a client that hasn't
+// answered with a pong within PongWait. Every write, including pings, must
+// complete within WriteTimeout. Every Heartbeat the server also sends a
+// heartbeat data message, for clients that can't see websocket pings:
+//
+//	{"stream": "heartbeat", "data": {"time": 1700000000000}}
+//
+// so a client that hears nothing for a few heartbeats knows the server is
+// gone. A zero Heartbeat disables heartbeat messages.
+type connConfig struct {
+	PingInterval time.Duration
+	PongWait     time.Duration
+	WriteTimeout time.Duration
+	Heartbeat    time.Duration
+}
+
+const streamHeartbeat = "heartbeat"
+
+type heartbeat struct {
+	Time int64 `json:"time"`
+}
+
+func (cfg connConfig) validate() error {
+	if cfg.PingInterval <= 0 || cfg.PongWait <= 0 || cfg.WriteTimeout <= 0 {
+		return fmt.Errorf("ping interval, pong wait and write timeout must be positive")
+	}
+	if cfg.PongWait <= cfg.PingInterval {
+		return fmt.Errorf("pong wait %v must be longer than the ping interval %v", cfg.PongWait, cfg.PingInterval)
+	}
+	return nil
+}
+
+// watchPongs makes reads fail once the client has gone PongWait without
+// answering a ping, which ends the connection's reader.
+func (c *client) watchPongs(cfg connConfig) {
+	c.ws.SetReadDeadline(time.Now().Add(cfg.PongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(cfg.PongWait))
+	})
+}
+
+// writeLoop sends the client's queued messages, pings and heartbeats
+// until the reader finishes (closing done), a write fails or the outbox
+// asks for the connection to be closed.
+func (c *client) writeLoop(cfg connConfig, done <-chan struct{}) {
+	ping := time.NewTicker(cfg.PingInterval)
+	defer ping.Stop()
+	var beat <-chan time.Time
+	if cfg.Heartbeat > 0 {
+		t := time.NewTicker(cfg.Heartbeat)
+		defer t.Stop()
+		beat = t.C
+	}
+
+	for {
+		select {
+		case <-done:
+			log.Println("Client disconnected")
+			return
+		case <-ping.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(cfg.WriteTimeout)); err != nil {
+				log.Println("Error sending ping:", err)
+				return
+			}
+			continue
+		case now := <-beat:
+			payload, _ := json.Marshal(streamMessage{Stream: streamHeartbeat, Data: heartbeat{Time: now.UnixMilli()}})
+			if err := c.write(payload, cfg.WriteTimeout); err != nil {
+				log.Println("Error sending heartbeat:", err)
+				return
+			}
+			continue
+		case <-c.out.notify:
+		}
+
+		msgs, code, text := c.out.drain()
+		for _, msg := range msgs {
+			if err := c.write(msg.payload, cfg.WriteTimeout); err != nil {
+				log.Println("Error writing message:", err)
+				return
+			}
+		}
+		if code != 0 {
+			c.close(code, text, cfg.WriteTimeout, done)
+			return
+		}
+	}
+}
+
+// close sends a close frame and gives the client up to timeout to answer
+// with its own, which ends the reader, before the connection is dropped.
+func (c *client) close(code int, text string, timeout time.Duration, done <-chan struct{}) {
+	log.Printf("Closing connection: %s", text)
+	err := c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(timeout))
+	if err != nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+func (c *client) write(payload []byte, timeout time.Duration) error {
+	c.ws.SetWriteDeadline(time.Now().Add(timeout))
+	return c.ws.WriteMessage(websocket.TextMessage, payload)
+}
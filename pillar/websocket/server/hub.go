@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// slowConsumerPolicy decides what happens when a client's send queue is
+// full because it isn't reading fast enough.
+type slowConsumerPolicy int
+
+const (
+	// dropOldest discards the oldest queued message to make room.
+	dropOldest slowConsumerPolicy = iota
+	// coalesce keeps only the latest message per stream, so a slow client
+	// skips intermediate ticks but always sees the newest state.
+	coalesce
+	// disconnect closes the connection.
+	disconnect
+)
+
+func parseSlowConsumerPolicy(s string) (slowConsumerPolicy, error) {
+	switch s {
+	case "drop-oldest":
+		return dropOldest, nil
+	case "coalesce":
+		return coalesce, nil
+	case "disconnect":
+		return disconnect, nil
+	}
+	return 0, fmt.Errorf("unknown slow consumer policy %q (want drop-oldest, coalesce or disconnect)", s)
+}
+
+// hub fans one feed out to all connected clients, so they all see the
+// same ticks. Each message is encoded once and shared between clients.
+type hub struct {
+	hasSymbol func(string) bool
+	policy    slowConsumerPolicy
+	queueSize int
+	recorder  *recorder // optional
+	market    *market   // nil when replaying
+
+	mu       sync.RWMutex
+	clients  map[*client]bool
+	closing  bool
+	draining sync.WaitGroup
+}
+
+func newHub(hasSymbol func(string) bool, policy slowConsumerPolicy, queueSize int) *hub {
+	return &hub{
+		hasSymbol: hasSymbol,
+		policy:    policy,
+		queueSize: queueSize,
+		clients:   make(map[*client]bool),
+	}
+}
+
+// register adds a client, or reports false once the hub is shutting down.
+func (h *hub) register(c *client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return false
+	}
+	h.clients[c] = true
+	h.draining.Add(1)
+	return true
+}
+
+func (h *hub) unregister(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[c] {
+		delete(h.clients, c)
+		h.draining.Done()
+	}
+}
+
+// shutdown closes every client normally, after whatever is already queued
+// for it, and waits for them to go until ctx is done. It returns how many
+// clients were still connected then.
+func (h *hub) shutdown(ctx context.Context) int {
+	h.mu.Lock()
+	h.closing = true
+	for c := range h.clients {
+		c.out.close(websocket.CloseNormalClosure, "server shutting down")
+	}
+	h.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		h.draining.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return 0
+	case <-ctx.Done():
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+		return len(h.clients)
+	}
+}
+
+// generate draws ticks from the simulated market forever at the rates
+// the load profile sets. Event times come from clock when it is set, and
+// from the wall clock otherwise.
+func (h *hub) generate(p loadProfile, clock *simClock) {
+	ticker := time.NewTicker(pacerInterval)
+	defer ticker.Stop()
+
+	pc := newPacer(p, time.Now())
+	reported, lastReport := int64(0), pc.start
+	for t := range ticker.C {
+		for range pc.take(t) {
+			now := t
+			if clock != nil {
+				now = clock.advance(p)
+			}
+			ev := h.market.next(now)
+			h.publish(ev.trade.Symbol, channelTrade, ev.trade, false)
+			h.publishTicker(ev.ticker)
+			if ev.hasBook {
+				h.publish(ev.book.Symbol, channelBook, ev.book, false)
+			}
+		}
+		if pc.skipped > reported && t.Sub(lastReport) >= time.Second {
+			log.Printf("Generator fell behind, skipped %d ticks", pc.skipped-reported)
+			reported, lastReport = pc.skipped, t
+		}
+	}
+}
+
+// subscribed sends a client a snapshot of each book it just subscribed
+// to. The subscription is already in place, so every update after the
+// snapshot reaches the client too.
+func (h *hub) subscribed(c *client, streams []string) {
+	if h.market == nil {
+		return
+	}
+	for _, stream := range streams {
+		symbol, channel, _ := strings.Cut(stream, "@")
+		if channel != channelBook {
+			continue
+		}
+		for _, book := range h.market.bookSnapshots(symbol) {
+			payload, err := json.Marshal(streamMessage{Stream: streamName(book.Symbol, channelBook), Data: book})
+			if err != nil {
+				log.Println("Error encoding message:", err)
+				return
+			}
+			c.out.push(streamName(book.Symbol, channelBook), payload, false)
+		}
+	}
+}
+
+// publishTicker records a tick, if recording, and sends it to subscribers.
+func (h *hub) publishTicker(tick TickerData) {
+	if h.recorder != nil {
+		if err := h.recorder.record(tick); err != nil {
+			log.Println("Error recording tick:", err)
+		}
+	}
+	h.publish(tick.Symbol, channelTicker, tick, true)
+}
+
+// publish queues data for every client subscribed to the stream. Only
+// messages that carry a stream's full state, like tickers, may be
+// coalesced; book updates build on each other and never are.
+func (h *hub) publish(symbol, channel string, data any, coalescable bool) {
+	stream := streamName(symbol, channel)
+	var payload []byte
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.clients {
+		if !c.subs.has(symbol, channel) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(streamMessage{Stream: stream, Data: data})
+			if err != nil {
+				log.Println("Error encoding message:", err)
+				return
+			}
+		}
+		c.out.push(stream, payload, coalescable)
+	}
+}
+
+// client is one websocket connection. The hub only ever touches its
+// subscriptions and outbox; the connection itself belongs to the
+// connection's reader and writer goroutines.
+type client struct {
+	ws   *websocket.Conn
+	subs *subscriptions
+	out  *outbox
+}
+
+// outbox is a client's bounded send queue. Pushes never block the hub:
+// when the queue is full the slow consumer policy decides what to drop.
+// Replies to requests are never dropped or coalesced.
+type outbox struct {
+	mu       sync.Mutex
+	policy   slowConsumerPolicy
+	size     int
+	queue    []*outMsg
+	byStream map[string]*outMsg
+	dropped  int
+
+	// closeCode is set once the connection should be closed, after what
+	// is already queued has been sent.
+	closeCode int
+	closeText string
+
+	notify chan struct{}
+}
+
+type outMsg struct {
+	stream  string
+	payload []byte
+}
+
+func newOutbox(policy slowConsumerPolicy, size int) *outbox {
+	return &outbox{
+		policy:   policy,
+		size:     size,
+		byStream: make(map[string]*outMsg),
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+func (o *outbox) push(stream string, payload []byte, coalescable bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closeCode != 0 {
+		return
+	}
+
+	coalescable = coalescable && o.policy == coalesce
+	if coalescable {
+		if msg, ok := o.byStream[stream]; ok {
+			msg.payload = payload
+			o.dropped++
+			return
+		}
+	}
+	if len(o.queue) >= o.size {
+		if o.policy == disconnect {
+			o.closeLocked(websocket.ClosePolicyViolation, "slow consumer")
+			return
+		}
+		if !o.dropOldest() {
+			o.dropped++ // only replies queued; this message is the oldest data
+			return
+		}
+	}
+	msg := &outMsg{stream: stream, payload: payload}
+	o.queue = append(o.queue, msg)
+	if coalescable {
+		o.byStream[stream] = msg
+	}
+	o.signal()
+}
+
+// dropOldest removes the oldest market data message, reporting false if
+// the queue holds only replies; the caller holds the lock.
+func (o *outbox) dropOldest() bool {
+	for i, msg := range o.queue {
+		if msg.stream == "" {
+			continue
+		}
+		if o.byStream[msg.stream] == msg {
+			delete(o.byStream, msg.stream)
+		}
+		o.queue = append(o.queue[:i], o.queue[i+1:]...)
+		o.dropped++
+		return true
+	}
+	return false
+}
+
+// reply queues a response to a client request. Replies are never dropped,
+// so when the queue is full one makes room by dropping market data, and a
+// client that keeps sending requests without reading the replies is
+// disconnected.
+func (o *outbox) reply(r response) {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		log.Println("Error encoding reply:", err)
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closeCode != 0 {
+		return
+	}
+	if len(o.queue) >= o.size && (o.policy == disconnect || !o.dropOldest()) {
+		o.closeLocked(websocket.ClosePolicyViolation, "slow consumer")
+		return
+	}
+	o.queue = append(o.queue, &outMsg{payload: payload})
+	o.signal()
+}
+
+func (o *outbox) signal() {
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// close asks for the connection to be closed with code and text once the
+// messages already queued are sent. Nothing more is queued after it.
+func (o *outbox) close(code int, text string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closeLocked(code, text)
+}
+
+func (o *outbox) closeLocked(code int, text string) {
+	if o.closeCode == 0 {
+		o.closeCode, o.closeText = code, text
+		o.signal()
+	}
+}
+
+// drain takes everything queued. A non-zero code means the connection
+// should then be closed with code and text.
+func (o *outbox) drain() (msgs []*outMsg, code int, text string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msgs, o.queue = o.queue, nil
+	clear(o.byStream)
+	return msgs, o.closeCode, o.closeText
+}
+
+// droppedCount reports how many messages were dropped or coalesced away.
+func (o *outbox) droppedCount() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.dropped
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestOutboxReplyDropsMarketData(t *testing.T) {
+	o := newOutbox(dropOldest, 4)
+	for range 4 {
+		o.push("A@ticker", []byte("tick"), true)
+	}
+	for i := range 3 {
+		o.reply(response{Id: int64(i)})
+	}
+
+	msgs, code, _ := o.drain()
+	if code != 0 {
+		t.Fatalf("closed with %d", code)
+	}
+	if len(msgs) != 4 {
+		t.Fatalf("%d messages queued, want 4", len(msgs))
+	}
+	if msgs[0].stream != "A@ticker" {
+		t.Errorf("newest tick was dropped")
+	}
+	for _, msg := range msgs[1:] {
+		if msg.stream != "" {
+			t.Errorf("reply dropped in favour of %s", msg.stream)
+		}
+	}
+	if o.droppedCount() != 3 {
+		t.Errorf("dropped %d, want 3", o.droppedCount())
+	}
+}
+
+func TestOutboxUnreadRepliesDisconnect(t *testing.T) {
+	for _, policy := range []slowConsumerPolicy{dropOldest, coalesce, disconnect} {
+		o := newOutbox(policy, 4)
+		for i := range 100 {
+			o.reply(response{Id: int64(i)})
+			o.push("A@ticker", []byte("tick"), true)
+		}
+
+		msgs, code, text := o.drain()
+		if code != websocket.ClosePolicyViolation || text != "slow consumer" {
+			t.Errorf("policy %d: close %d %q, want %d", policy, code, text, websocket.ClosePolicyViolation)
+		}
+		if len(msgs) > 4 {
+			t.Errorf("policy %d: %d messages queued, limit 4", policy, len(msgs))
+		}
+	}
+}
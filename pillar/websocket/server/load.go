@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// profileKind is the shape of the load the market generates over time.
+type profileKind int
+
+const (
+	// steady sends at a constant rate.
+	steady profileKind = iota
+	// bursty sends at the base rate with regular spikes, like the rush
+	// at a market open. Each period of BurstEvery starts with BurstLength
+	// at BurstFactor times the rate.
+	bursty
+	// ramp climbs linearly from nothing to the rate over RampUp, then
+	// holds it.
+	ramp
+)
+
+func parseProfileKind(s string) (profileKind, error) {
+	switch s {
+	case "steady":
+		return steady, nil
+	case "bursty":
+		return bursty, nil
+	case "ramp":
+		return ramp, nil
+	}
+	return 0, fmt.Errorf("unknown load profile %q (want steady, bursty or ramp)", s)
+}
+
+// loadProfile sets how many ticks per second the market generates, across
+// all symbols and for every client alike.
+type loadProfile struct {
+	Kind        profileKind
+	Rate        float64 // ticks per second
+	BurstFactor float64
+	BurstEvery  time.Duration
+	BurstLength time.Duration
+	RampUp      time.Duration
+}
+
+// minRampFraction keeps a ramp from starting at a standstill.
+const minRampFraction = 0.01
+
+func (p loadProfile) validate() error {
+	if p.Rate <= 0 {
+		return fmt.Errorf("rate must be positive, got %v", p.Rate)
+	}
+	switch p.Kind {
+	case bursty:
+		if p.BurstFactor < 1 {
+			return fmt.Errorf("burst factor must be at least 1, got %v", p.BurstFactor)
+		}
+		if p.BurstLength <= 0 || p.BurstEvery <= p.BurstLength {
+			return fmt.Errorf("bursts of %v every %v don't fit", p.BurstLength, p.BurstEvery)
+		}
+	case ramp:
+		if p.RampUp <= 0 {
+			return fmt.Errorf("ramp-up must be positive, got %v", p.RampUp)
+		}
+	}
+	return nil
+}
+
+// rateAt returns the tick rate elapsed into the run.
+func (p loadProfile) rateAt(elapsed time.Duration) float64 {
+	switch p.Kind {
+	case bursty:
+		if elapsed%p.BurstEvery < p.BurstLength {
+			return p.Rate * p.BurstFactor
+		}
+	case ramp:
+		if elapsed < p.RampUp {
+			return p.Rate * max(float64(elapsed)/float64(p.RampUp), minRampFraction)
+		}
+	}
+	return p.Rate
+}
+
+// pacerInterval is how often the generator wakes to send the ticks that
+// have fallen due, so rates above one tick per millisecond go out in
+// small batches rather than depending on finer sleeps.
+const pacerInterval = time.Millisecond
+
+// pacer works out how many ticks are due each time the generator wakes.
+// When generation falls behind, only one pacer interval's worth of ticks
+// at the current rate is carried over and the rest are skipped, so the
+// backlog of a burst doesn't pour out at full speed after it ends and
+// flatten the profile's shape.
+type pacer struct {
+	profile     loadProfile
+	start, last time.Time
+	due         float64
+	skipped     int64 // ticks dropped because generation fell behind
+}
+
+func newPacer(p loadProfile, start time.Time) *pacer {
+	return &pacer{profile: p, start: start, last: start}
+}
+
+// take returns the number of ticks to send at t.
+func (pc *pacer) take(t time.Time) int {
+	rate := pc.profile.rateAt(t.Sub(pc.start))
+	pc.due += rate * t.Sub(pc.last).Seconds()
+	pc.last = t
+	// a whole interval plus the fraction of a tick carried from the last one
+	if limit := rate*pacerInterval.Seconds() + 1; pc.due > limit {
+		skip := math.Floor(pc.due - limit)
+		pc.skipped += int64(skip)
+		pc.due -= skip
+	}
+	n := math.Floor(pc.due)
+	pc.due -= n
+	return int(n)
+}
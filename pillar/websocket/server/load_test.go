@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateAt(t *testing.T) {
+	burst := loadProfile{Kind: bursty, Rate: 100, BurstFactor: 5, BurstEvery: time.Second, BurstLength: 200 * time.Millisecond}
+	climb := loadProfile{Kind: ramp, Rate: 100, RampUp: 10 * time.Second}
+	for _, tc := range []struct {
+		name    string
+		profile loadProfile
+		elapsed time.Duration
+		want    float64
+	}{
+		{"steady", loadProfile{Kind: steady, Rate: 100}, time.Hour, 100},
+		{"burst start", burst, 0, 500},
+		{"burst end", burst, 199 * time.Millisecond, 500},
+		{"after burst", burst, 200 * time.Millisecond, 100},
+		{"before next burst", burst, 999 * time.Millisecond, 100},
+		{"next burst", burst, 3100 * time.Millisecond, 500},
+		{"ramp start", climb, 0, 100 * minRampFraction},
+		{"ramp middle", climb, 5 * time.Second, 50},
+		{"ramp end", climb, 10 * time.Second, 100},
+		{"after ramp", climb, time.Minute, 100},
+	} {
+		if got := tc.profile.rateAt(tc.elapsed); got != tc.want {
+			t.Errorf("%s: rateAt(%v) = %v, want %v", tc.name, tc.elapsed, got, tc.want)
+		}
+	}
+}
+
+func TestValidateLoadProfile(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		profile loadProfile
+		ok      bool
+	}{
+		{"steady", loadProfile{Kind: steady, Rate: 1}, true},
+		{"zero rate", loadProfile{Kind: steady}, false},
+		{"bursty", loadProfile{Kind: bursty, Rate: 1, BurstFactor: 2, BurstEvery: time.Second, BurstLength: time.Millisecond}, true},
+		{"burst factor", loadProfile{Kind: bursty, Rate: 1, BurstFactor: 0.5, BurstEvery: time.Second, BurstLength: time.Millisecond}, false},
+		{"burst too long", loadProfile{Kind: bursty, Rate: 1, BurstFactor: 2, BurstEvery: time.Second, BurstLength: time.Second}, false},
+		{"ramp", loadProfile{Kind: ramp, Rate: 1, RampUp: time.Second}, true},
+		{"no ramp-up", loadProfile{Kind: ramp, Rate: 1}, false},
+	} {
+		if err := tc.profile.validate(); (err == nil) != tc.ok {
+			t.Errorf("%s: validate() = %v", tc.name, err)
+		}
+	}
+}
+
+// On time, the pacer sends exactly the profile's rate, fractions included.
+func TestPacerKeepsRate(t *testing.T) {
+	start := time.Now()
+	pc := newPacer(loadProfile{Kind: steady, Rate: 1500}, start)
+	sent := 0
+	for i := 1; i <= 1000; i++ {
+		sent += pc.take(start.Add(time.Duration(i) * pacerInterval))
+	}
+	if sent < 1499 || sent > 1500 || pc.skipped != 0 {
+		t.Errorf("sent %d ticks and skipped %d in a second at 1500/s", sent, pc.skipped)
+	}
+}
+
+// A stall during a burst must not carry the burst's backlog into the
+// quieter time after it.
+func TestPacerCapsBacklog(t *testing.T) {
+	p := loadProfile{Kind: bursty, Rate: 1000, BurstFactor: 10, BurstEvery: time.Second, BurstLength: 100 * time.Millisecond}
+	start := time.Now()
+	pc := newPacer(p, start)
+	if n := pc.take(start.Add(pacerInterval)); n != 10 {
+		t.Fatalf("%d ticks due in the first interval of a burst, want 10", n)
+	}
+	// stalled until the burst is over: 100ms at the base rate fall due,
+	// of which only one interval's worth plus a tick are sent
+	if n := pc.take(start.Add(101 * time.Millisecond)); n != 2 {
+		t.Errorf("%d ticks due after the stall, want 2", n)
+	}
+	if pc.skipped != 98 {
+		t.Errorf("skipped %d ticks, want 98", pc.skipped)
+	}
+	if n := pc.take(start.Add(102 * time.Millisecond)); n != 1 {
+		t.Errorf("%d ticks due the interval after, want the base rate's 1", n)
+	}
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
-	"math/rand"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/rasha-hantash/interviews/pillar/decimal"
 )
 
 var upgrader = websocket.Upgrader{
@@ -14,55 +21,157 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
-var cryptoSymbols = []string{
-	"BTCUSDT", "ETHUSDT", "XRPUSDT", "LTCUSDT", "ADAUSDT",
-	"DOTUSDT", "LINKUSDT", "BNBUSDT", "SOLUSDT", "DOGEUSDT",
-	"UNIUSDT", "MATICUSDT", "AVAXUSDT", "ATOMUSDT", "ALGOUSDT",
-	"XTZUSDT", "XLMUSDT", "VETUSDT", "FILUSDT", "TRXUSDT",
-}
-
 type TickerData struct {
-	EventTime       int64   `json:"event_time"`
-	Symbol          string  `json:"symbol"`
-	Price           float64  `json:"price"`
-	PriceChange     float64 `json:"price_change"`
-	PriceChangePercent float64 `json:"price_change_percent"`
-	WeightedAvgPrice float64 `json:"weighted_avg_price"`
-	PrevClosePrice  float64 `json:"prev_close_price"`
-	LastQty         float64 `json:"last_qty"`
-	BidPrice        float64 `json:"bid_price"`
-	AskPrice        float64 `json:"ask_price"`
-	OpenPrice       float64 `json:"open_price"`
-	HighPrice       float64 `json:"high_price"`
-	LowPrice        float64 `json:"low_price"`
-	Volume          float64 `json:"volume"`
-	QuoteVolume     float64 `json:"quote_volume"`
-	OpenTime        int64   `json:"open_time"`
-	CloseTime       int64   `json:"close_time"`
-	FirstId         int64   `json:"first_id"`
-	LastId          int64   `json:"last_id"`
-	Count           int64   `json:"count"`
+	EventTime          int64           `json:"event_time"`
+	Symbol             string          `json:"symbol"`
+	Price              decimal.Decimal `json:"price"`
+	PriceChange        decimal.Decimal `json:"price_change"`
+	PriceChangePercent decimal.Decimal `json:"price_change_percent"`
+	WeightedAvgPrice   decimal.Decimal `json:"weighted_avg_price"`
+	PrevClosePrice     decimal.Decimal `json:"prev_close_price"`
+	LastQty            float64         `json:"last_qty"`
+	BidPrice           decimal.Decimal `json:"bid_price"`
+	AskPrice           decimal.Decimal `json:"ask_price"`
+	OpenPrice          decimal.Decimal `json:"open_price"`
+	HighPrice          decimal.Decimal `json:"high_price"`
+	LowPrice           decimal.Decimal `json:"low_price"`
+	Volume             float64         `json:"volume"`
+	QuoteVolume        float64         `json:"quote_volume"`
+	OpenTime           int64           `json:"open_time"`
+	CloseTime          int64           `json:"close_time"`
+	FirstId            int64           `json:"first_id"`
+	LastId             int64           `json:"last_id"`
+	Count              int64           `json:"count"`
 }
 
-// Global random number generator
-var rng *rand.Rand
-
-func init() {
-	// Initialize the random number generator with a time-based seed
-	source := rand.NewSource(time.Now().UnixNano())
-	rng = rand.New(source)
-}
+// sim is the simulated market and marketHub fans its ticks out to every
+// connection.
+var (
+	sim       *market
+	marketHub *hub
+)
 
+// connSettings applies to every connection.
+var connSettings connConfig
 
 func main() {
+	marketConfig := flag.String("market", "", "JSON file of symbol configs (default: built-in symbols)")
+	drift := flag.Float64("drift", 0, "default annualised drift of the price random walk")
+	volatility := flag.Float64("volatility", 0.8, "default annualised volatility of the price random walk")
+	queueSize := flag.Int("queue-size", 256, "messages queued per client before the slow consumer policy applies")
+	slowConsumer := flag.String("slow-consumer", "drop-oldest", "what to do when a client's queue is full: drop-oldest, coalesce or disconnect")
+	replay := flag.String("replay", "", "NDJSON file of recorded ticks to replay instead of simulating the market")
+	speed := flag.Float64("speed", 1, "replay speed relative to the recording; 0 replays as fast as possible")
+	loop := flag.Bool("loop", false, "restart the replay when it reaches the end of the recording")
+	record := flag.String("record", "", "NDJSON file to record every published tick to")
+	seedFlag := flag.String("seed", os.Getenv("MARKET_SEED"), "seed for a reproducible market on a simulated clock (default $MARKET_SEED, else random)")
+	flag.DurationVar(&connSettings.PingInterval, "ping-interval", 15*time.Second, "how often to ping each client")
+	flag.DurationVar(&connSettings.PongWait, "pong-wait", 30*time.Second, "drop a client that hasn't answered a ping for this long")
+	flag.DurationVar(&connSettings.WriteTimeout, "write-timeout", 10*time.Second, "drop a client when a write takes longer than this")
+	flag.DurationVar(&connSettings.Heartbeat, "heartbeat", 5*time.Second, "interval between heartbeat messages; 0 disables them")
+	var load loadProfile
+	profile := flag.String("profile", "steady", "load profile: steady, bursty or ramp")
+	flag.Float64Var(&load.Rate, "rate", 1000, "ticks per second across all symbols (the base rate for bursty, the final rate for ramp)")
+	flag.Float64Var(&load.BurstFactor, "burst-factor", 10, "bursty profile: rate multiplier during a burst")
+	flag.DurationVar(&load.BurstEvery, "burst-every", 30*time.Second, "bursty profile: time from one burst to the next")
+	flag.DurationVar(&load.BurstLength, "burst-length", 5*time.Second, "bursty profile: how long each burst lasts")
+	flag.DurationVar(&load.RampUp, "ramp-up", time.Minute, "ramp profile: time to climb to the full rate")
+	drainTimeout := flag.Duration("drain-timeout", 5*time.Second, "how long to wait for clients to close on shutdown")
+	flag.Parse()
+
+	if err := connSettings.validate(); err != nil {
+		log.Fatal(err)
+	}
+	kind, err := parseProfileKind(*profile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	load.Kind = kind
+	if err := load.validate(); err != nil {
+		log.Fatal("load profile: ", err)
+	}
+	policy, err := parseSlowConsumerPolicy(*slowConsumer)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	http.HandleFunc("/ws", handleConnections)
+	var rec *recorder
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			log.Fatal("record: ", err)
+		}
+		defer f.Close()
+		rec = newRecorder(f)
+	}
 
-	log.Println("Starting server on :8081")
-	err := http.ListenAndServe(":8081", nil)
-	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
+	if *replay != "" {
+		r, err := newReplayer(*replay, *speed, *loop)
+		if err != nil {
+			log.Fatal("replay: ", err)
+		}
+		// Recordings only carry tickers.
+		delete(channels, channelTrade)
+		delete(channels, channelBook)
+		marketHub = newHub(r.hasSymbol, policy, *queueSize)
+		marketHub.recorder = rec
+		go func() {
+			if err := r.run(marketHub.publishTicker); err != nil {
+				log.Println("Replay stopped:", err)
+				return
+			}
+			log.Println("Replay finished")
+		}()
+	} else {
+		symbols, err := loadSymbols(*marketConfig)
+		if err != nil {
+			log.Fatal("market config: ", err)
+		}
+
+		// Seeded runs use a simulated clock as well, since wall-clock event
+		// times and step sizes would differ from run to run.
+		seed, start := time.Now().UnixNano(), time.Now()
+		var clock *simClock
+		if *seedFlag != "" {
+			seed, err = strconv.ParseInt(*seedFlag, 10, 64)
+			if err != nil {
+				log.Fatal("seed: ", err)
+			}
+			start, clock = simEpoch, &simClock{t: simEpoch}
+		}
+		log.Println("Market seed:", seed)
+
+		sim = newMarket(symbols, *drift, *volatility, seed, start)
+		marketHub = newHub(sim.hasSymbol, policy, *queueSize)
+		marketHub.recorder = rec
+		marketHub.market = sim
+		go marketHub.generate(load, clock)
 	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", handleConnections)
+	srv := &http.Server{Addr: ":8081", Handler: mux}
+	go func() {
+		log.Println("Starting server on :8081")
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("ListenAndServe: ", err)
+		}
+	}()
+	<-ctx.Done()
+
+	// Stop taking new connections, then close the open ones once they
+	// have been sent what is already queued for them.
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+	if n := marketHub.shutdown(shutdownCtx); n > 0 {
+		log.Printf("Drain timed out, dropping %d open connection(s)", n)
+	}
+	log.Println("Server stopped")
 }
 
 func handleConnections(w http.ResponseWriter, r *http.Request) {
@@ -75,58 +184,28 @@ func handleConnections(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("Client connected")
 
-	for {
-		err := ws.WriteJSON(generateData())
-		if err != nil {
-			log.Println("Error writing message:", err)
-			break
-		}
-		time.Sleep(time.Millisecond) // Send data every second
-	}
-}
-
-func generateData() TickerData {
-	now := time.Now()
-	fourSecondsAgo := now.Add(-4 * time.Second)
-	symbol := cryptoSymbols[rng.Intn(len(cryptoSymbols))]
-	basePrice := 40000.0
-	if symbol != "BTCUSD" {
-		basePrice = 100.0 // Adjust base price for non-BTC symbols
+	c := &client{
+		ws:   ws,
+		subs: newSubscriptions(),
+		out:  newOutbox(marketHub.policy, marketHub.queueSize),
 	}
-	
-	price := basePrice + rng.Float64()*basePrice*0.1 // 10% variation
-	prevClosePrice := basePrice + rng.Float64()*basePrice*0.1
-	priceChange := price - prevClosePrice
-	priceChangePercent := (priceChange / prevClosePrice) * 100
-
-	return TickerData{
-		EventTime:         generateTimestamp(fourSecondsAgo, now),
-		Symbol:             symbol,
-		Price:              price,
-		PriceChange:        priceChange,
-		PriceChangePercent: priceChangePercent,
-		WeightedAvgPrice:   price + rng.Float64()*10 - 5,
-		PrevClosePrice:     prevClosePrice,
-		LastQty:            rng.Float64() * 10,
-		BidPrice:           price - rng.Float64(),
-		AskPrice:           price + rng.Float64(),
-		OpenPrice:          prevClosePrice,
-		HighPrice:          price + rng.Float64()*10,
-		LowPrice:           price - rng.Float64()*10,
-		Volume:             10000 + rng.Float64()*90000,
-		QuoteVolume:        (10000 + rng.Float64()*90000) * price,
-		OpenTime:           now.Add(-24 * time.Hour).UnixNano() / int64(time.Millisecond),
-		CloseTime:          now.UnixNano() / int64(time.Millisecond),
-		FirstId:            now.UnixNano() - 1000000,
-		LastId:             now.UnixNano(),
-		Count:              100 + rng.Int63n(900),
+	if !marketHub.register(c) {
+		ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+			time.Now().Add(connSettings.WriteTimeout))
+		return
 	}
-}
+	defer func() {
+		marketHub.unregister(c)
+		if n := c.out.droppedCount(); n > 0 {
+			log.Printf("Dropped %d messages for slow client", n)
+		}
+	}()
 
-func generateTimestamp(start, end time.Time) int64 {
-	if rng.Float32() < 0.95 {
-		return end.UnixNano() / int64(time.Millisecond)
-	}
-	diff := end.Sub(start)
-	return start.Add(time.Duration(rng.Int63n(int64(diff)))).UnixNano() / int64(time.Millisecond)
-}
\ No newline at end of file
+	c.watchPongs(connSettings)
+	done := make(chan struct{})
+	subscribed := func(streams []string) { marketHub.subscribed(c, streams) }
+	go readRequests(ws, c.subs, marketHub.hasSymbol, c.out.reply, subscribed, done)
+
+	c.writeLoop(connSettings, done)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startServer serves handleConnections against a fresh hub without a
+// running market, so the only traffic is replies and close frames.
+func startServer(t *testing.T) string {
+	t.Helper()
+	prevSim, prevHub, prevSettings := sim, marketHub, connSettings
+	t.Cleanup(func() { sim, marketHub, connSettings = prevSim, prevHub, prevSettings })
+
+	sim = newMarket(defaultSymbols, 0, 0.8, 1, simEpoch)
+	marketHub = newHub(sim.hasSymbol, dropOldest, 16)
+	marketHub.market = sim
+	connSettings = connConfig{PingInterval: time.Second, PongWait: 2 * time.Second, WriteTimeout: time.Second}
+
+	// hijacked connections outlive srv.Close, so wait for their handlers
+	// before the globals are put back
+	var handlers sync.WaitGroup
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.Add(1)
+		defer handlers.Done()
+		handleConnections(w, r)
+	}))
+	t.Cleanup(func() {
+		srv.Close()
+		handlers.Wait()
+	})
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return ws
+}
+
+// readClose reads until the server closes the connection and returns the
+// close frame it sent.
+func readClose(t *testing.T, ws *websocket.Conn) *websocket.CloseError {
+	t.Helper()
+	for {
+		_, _, err := ws.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) {
+			t.Fatalf("connection ended without a close frame: %v", err)
+		}
+		return closeErr
+	}
+}
+
+func TestShutdownClosesClientsNormally(t *testing.T) {
+	url := startServer(t)
+	clients := []*websocket.Conn{dial(t, url), dial(t, url)}
+	for i, ws := range clients {
+		// a reply means the connection has been registered with the hub
+		if err := ws.WriteJSON(request{Id: int64(i), Method: "list_subscriptions"}); err != nil {
+			t.Fatal(err)
+		}
+		var r response
+		if err := ws.ReadJSON(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan int)
+	go func() { done <- marketHub.shutdown(ctx) }()
+
+	for _, ws := range clients {
+		closeErr := readClose(t, ws)
+		if closeErr.Code != websocket.CloseNormalClosure || closeErr.Text != "server shutting down" {
+			t.Errorf("closed with %d %q, want %d %q", closeErr.Code, closeErr.Text, websocket.CloseNormalClosure, "server shutting down")
+		}
+	}
+	if n := <-done; n != 0 {
+		t.Errorf("shutdown left %d connections open", n)
+	}
+}
+
+func TestConnectDuringShutdownIsRefused(t *testing.T) {
+	url := startServer(t)
+	if n := marketHub.shutdown(context.Background()); n != 0 {
+		t.Fatalf("shutdown left %d connections open", n)
+	}
+
+	closeErr := readClose(t, dial(t, url))
+	if closeErr.Code != websocket.CloseGoingAway {
+		t.Errorf("closed with %d, want %d", closeErr.Code, websocket.CloseGoingAway)
+	}
+}
+
+func TestOversizedRequestClosesConnection(t *testing.T) {
+	ws := dial(t, startServer(t))
+	params := []string{strings.Repeat("A", maxRequestSize)}
+	if err := ws.WriteJSON(request{Id: 1, Method: "subscribe", Params: params}); err != nil {
+		t.Fatal(err)
+	}
+	if closeErr := readClose(t, ws); closeErr.Code != websocket.CloseMessageTooBig {
+		t.Errorf("closed with %d, want %d", closeErr.Code, websocket.CloseMessageTooBig)
+	}
+}
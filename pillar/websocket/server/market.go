@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+// secondsPerYear converts wall-clock steps into the annualised units that
+// drift and volatility are quoted in.
+const secondsPerYear = 365 * 24 * 60 * 60
+
+// SymbolConfig describes how one symbol's price evolves. Drift and
+// Volatility are annualised, as for geometric Brownian motion; zero values
+// fall back to the -drift and -volatility flags. SpreadBps is the
+// quoted bid/ask spread in basis points of the mid price, and TradeSize
+// the mean notional of a trade in quote currency.
+type SymbolConfig struct {
+	Symbol     string  `json:"symbol"`
+	BasePrice  float64 `json:"base_price"`
+	Decimals   int     `json:"decimals"`
+	Drift      float64 `json:"drift"`
+	Volatility float64 `json:"volatility"`
+	SpreadBps  float64 `json:"spread_bps"`
+	TradeSize  float64 `json:"trade_size"`
+}
+
+var defaultSymbols = []SymbolConfig{
+	{Symbol: "BTCUSDT", BasePrice: 40000, Decimals: 2},
+	{Symbol: "ETHUSDT", BasePrice: 2500, Decimals: 2},
+	{Symbol: "XRPUSDT", BasePrice: 0.5, Decimals: 4},
+	{Symbol: "LTCUSDT", BasePrice: 80, Decimals: 2},
+	{Symbol: "ADAUSDT", BasePrice: 0.4, Decimals: 4},
+	{Symbol: "DOTUSDT", BasePrice: 6, Decimals: 3},
+	{Symbol: "LINKUSDT", BasePrice: 14, Decimals: 3},
+	{Symbol: "BNBUSDT", BasePrice: 300, Decimals: 2},
+	{Symbol: "SOLUSDT", BasePrice: 100, Decimals: 2},
+	{Symbol: "DOGEUSDT", BasePrice: 0.08, Decimals: 5},
+	{Symbol: "UNIUSDT", BasePrice: 6, Decimals: 3},
+	{Symbol: "MATICUSDT", BasePrice: 0.7, Decimals: 4},
+	{Symbol: "AVAXUSDT", BasePrice: 25, Decimals: 2},
+	{Symbol: "ATOMUSDT", BasePrice: 9, Decimals: 3},
+	{Symbol: "ALGOUSDT", BasePrice: 0.15, Decimals: 4},
+	{Symbol: "XTZUSDT", BasePrice: 0.8, Decimals: 4},
+	{Symbol: "XLMUSDT", BasePrice: 0.11, Decimals: 5},
+	{Symbol: "VETUSDT", BasePrice: 0.02, Decimals: 5},
+	{Symbol: "FILUSDT", BasePrice: 5, Decimals: 3},
+	{Symbol: "TRXUSDT", BasePrice: 0.1, Decimals: 5},
+}
+
+// loadSymbols reads a JSON array of SymbolConfig, or returns the built-in
+// table when path is empty.
+func loadSymbols(path string) ([]SymbolConfig, error) {
+	if path == "" {
+		return defaultSymbols, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var symbols []SymbolConfig
+	if err := json.Unmarshal(data, &symbols); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateSymbols(symbols); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return symbols, nil
+}
+
+// validateSymbols rejects configs the simulation can't run: a zero price
+// would make every trade size infinite, and the ticker could no longer be
+// encoded.
+func validateSymbols(symbols []SymbolConfig) error {
+	if len(symbols) == 0 {
+		return errors.New("no symbols")
+	}
+	seen := make(map[string]bool, len(symbols))
+	for i, cfg := range symbols {
+		switch {
+		case cfg.Symbol == "":
+			return fmt.Errorf("symbol %d has no name", i)
+		case strings.ContainsAny(cfg.Symbol, "@*"):
+			return fmt.Errorf("symbol %q can't contain @ or *", cfg.Symbol)
+		case seen[cfg.Symbol]:
+			return fmt.Errorf("symbol %q is listed twice", cfg.Symbol)
+		case !(cfg.BasePrice > 0) || math.IsInf(cfg.BasePrice, 0):
+			return fmt.Errorf("symbol %q: base price must be positive, got %v", cfg.Symbol, cfg.BasePrice)
+		case cfg.Decimals < 0 || cfg.Decimals > decimal.MaxScale:
+			return fmt.Errorf("symbol %q: decimals must be between 0 and %d, got %d", cfg.Symbol, decimal.MaxScale, cfg.Decimals)
+		case cfg.SpreadBps < 0:
+			return fmt.Errorf("symbol %q: spread must not be negative, got %v", cfg.Symbol, cfg.SpreadBps)
+		case cfg.TradeSize < 0:
+			return fmt.Errorf("symbol %q: trade size must not be negative, got %v", cfg.Symbol, cfg.TradeSize)
+		case cfg.Volatility < 0:
+			return fmt.Errorf("symbol %q: volatility must not be negative, got %v", cfg.Symbol, cfg.Volatility)
+		}
+		seen[cfg.Symbol] = true
+	}
+	return nil
+}
+
+// market simulates every symbol's mid price as an independent geometric
+// Brownian motion. Each tick is one trade that executes at the bid or ask,
+// and the 24h-style ticker aggregates are accumulated from those trades
+// since the market opened, so they stay consistent from tick to tick.
+//
+// All randomness derives from one seed: rng picks which symbol ticks next
+// and each symbol draws from its own generator, so a symbol's path doesn't
+// depend on how many other symbols are configured.
+type market struct {
+	mu      sync.Mutex
+	rng     *rand.Rand
+	symbols []*symbolState
+}
+
+type symbolState struct {
+	cfg  SymbolConfig
+	rng  *rand.Rand
+	mid  float64
+	last time.Time
+	book *orderBook
+
+	openTime int64
+	open     decimal.Decimal
+	price    decimal.Decimal
+	high     decimal.Decimal
+	low      decimal.Decimal
+	bid      decimal.Decimal
+	ask      decimal.Decimal
+
+	lastQty     float64
+	lastSide    string
+	volume      float64
+	quoteVolume float64
+	firstId     int64
+	lastId      int64
+	count       int64
+}
+
+func newMarket(configs []SymbolConfig, drift, volatility float64, seed int64, now time.Time) *market {
+	m := &market{rng: rand.New(rand.NewSource(seed))}
+	for _, cfg := range configs {
+		if cfg.Drift == 0 {
+			cfg.Drift = drift
+		}
+		if cfg.Volatility == 0 {
+			cfg.Volatility = volatility
+		}
+		if cfg.SpreadBps == 0 {
+			cfg.SpreadBps = 2
+		}
+		if cfg.TradeSize == 0 {
+			cfg.TradeSize = 5000
+		}
+		open := decimal.FromFloatScale(cfg.BasePrice, cfg.Decimals)
+		rng := symbolRand(seed, cfg.Symbol)
+		firstId := rng.Int63n(1_000_000_000)
+		s := &symbolState{
+			cfg:      cfg,
+			rng:      rng,
+			mid:      cfg.BasePrice,
+			last:     now,
+			openTime: now.UnixMilli(),
+			open:     open,
+			price:    open,
+			high:     open,
+			low:      open,
+			firstId:  firstId,
+			lastId:   firstId - 1,
+			book:     newOrderBook(now),
+		}
+		s.quote()
+		s.book.bids = s.bookSide(nil, s.bid, decimal.New(-1, cfg.Decimals))
+		s.book.asks = s.bookSide(nil, s.ask, decimal.New(1, cfg.Decimals))
+		m.symbols = append(m.symbols, s)
+	}
+	return m
+}
+
+// symbolRand returns the generator for one symbol under seed.
+func symbolRand(seed int64, symbol string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(symbol))
+	return rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+}
+
+func (m *market) hasSymbol(symbol string) bool {
+	for _, s := range m.symbols {
+		if s.cfg.Symbol == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// marketEvent is everything one step of the market publishes.
+type marketEvent struct {
+	trade   TradeData
+	ticker  TickerData
+	book    BookData
+	hasBook bool
+}
+
+// next advances a randomly chosen symbol to now and returns its trade,
+// ticker and book update.
+func (m *market) next(now time.Time) marketEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.symbols[m.rng.Intn(len(m.symbols))]
+	s.step(now)
+	s.trade()
+	ev := marketEvent{trade: s.lastTrade(now), ticker: s.ticker(now)}
+	ev.book, ev.hasBook = s.updateBook(now)
+	return ev
+}
+
+// bookSnapshots returns the books of symbol, or of every symbol for "*".
+func (m *market) bookSnapshots(symbol string) []BookData {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var books []BookData
+	for _, s := range m.symbols {
+		if symbol == "*" || s.cfg.Symbol == symbol {
+			books = append(books, s.snapshot())
+		}
+	}
+	return books
+}
+
+// step moves the mid price along its random walk by the time elapsed
+// since the symbol last moved.
+func (s *symbolState) step(now time.Time) {
+	dt := now.Sub(s.last).Seconds() / secondsPerYear
+	s.last = now
+	if dt <= 0 {
+		return
+	}
+	mu, sigma := s.cfg.Drift, s.cfg.Volatility
+	s.mid *= math.Exp((mu-sigma*sigma/2)*dt + sigma*math.Sqrt(dt)*s.rng.NormFloat64())
+	s.quote()
+}
+
+// quote sets bid and ask around the mid, at least one price increment
+// apart.
+func (s *symbolState) quote() {
+	half := s.mid * s.cfg.SpreadBps / 20000
+	s.bid = decimal.FromFloatScale(s.mid-half, s.cfg.Decimals)
+	s.ask = decimal.FromFloatScale(s.mid+half, s.cfg.Decimals)
+	if s.ask.Cmp(s.bid) <= 0 {
+		s.ask = s.bid.Add(decimal.New(1, s.cfg.Decimals))
+	}
+}
+
+// trade executes one trade against the current quote, buying at the ask
+// or selling at the bid with equal probability.
+func (s *symbolState) trade() {
+	price, side := s.bid, sideSell
+	if s.rng.Intn(2) == 0 {
+		price, side = s.ask, sideBuy
+	}
+	qty := s.rng.ExpFloat64() * s.cfg.TradeSize / s.mid
+
+	s.lastId++
+	s.count++
+	s.price = price
+	s.lastQty = qty
+	s.lastSide = side
+	s.volume += qty
+	s.quoteVolume += qty * price.Float64()
+	if price.Cmp(s.high) > 0 {
+		s.high = price
+	}
+	if price.Cmp(s.low) < 0 {
+		s.low = price
+	}
+}
+
+func (s *symbolState) ticker(now time.Time) TickerData {
+	change := s.price.Sub(s.open)
+	percent, _ := change.Mul(decimal.New(100, 0), change.Scale()).Div(s.open, 3)
+	return TickerData{
+		EventTime:          generateTimestamp(s.rng, now.Add(-4*time.Second), now),
+		Symbol:             s.cfg.Symbol,
+		Price:              s.price,
+		PriceChange:        change,
+		PriceChangePercent: percent,
+		WeightedAvgPrice:   decimal.FromFloatScale(s.quoteVolume/s.volume, s.cfg.Decimals),
+		PrevClosePrice:     s.open,
+		LastQty:            s.lastQty,
+		BidPrice:           s.bid,
+		AskPrice:           s.ask,
+		OpenPrice:          s.open,
+		HighPrice:          s.high,
+		LowPrice:           s.low,
+		Volume:             s.volume,
+		QuoteVolume:        s.quoteVolume,
+		OpenTime:           s.openTime,
+		CloseTime:          now.UnixMilli(),
+		FirstId:            s.firstId,
+		LastId:             s.lastId,
+		Count:              s.count,
+	}
+}
+
+// generateTimestamp returns end most of the time, but occasionally a time
+// up to start, so clients see some out-of-order event times.
+func generateTimestamp(rng *rand.Rand, start, end time.Time) int64 {
+	if rng.Float32() < 0.95 {
+		return end.UnixNano() / int64(time.Millisecond)
+	}
+	diff := end.Sub(start)
+	return start.Add(time.Duration(rng.Int63n(int64(diff)))).UnixNano() / int64(time.Millisecond)
+}
+
+// simEpoch is where the simulated clock starts, so seeded runs produce the
+// same event times on every run.
+var simEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// simClock is a clock that advances one tick at a time, decoupling seeded
+// runs from wall-clock time. Each tick moves it on by one tick's worth of
+// time at the load profile's rate, so simulated time keeps pace with real
+// time without depending on it.
+type simClock struct {
+	t time.Time
+}
+
+func (c *simClock) advance(p loadProfile) time.Time {
+	c.t = c.t.Add(time.Duration(float64(time.Second) / p.rateAt(c.t.Sub(simEpoch))))
+	return c.t
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultSymbolsAreValid(t *testing.T) {
+	if err := validateSymbols(defaultSymbols); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadSymbolsRejectsBadConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name, config, want string
+	}{
+		{"empty", `[]`, "no symbols"},
+		{"no name", `[{"base_price": 10}]`, "has no name"},
+		{"separator", `[{"symbol": "A@B", "base_price": 10}]`, "can't contain"},
+		{"duplicate", `[{"symbol": "A", "base_price": 10}, {"symbol": "A", "base_price": 20}]`, "listed twice"},
+		{"zero price", `[{"symbol": "A"}]`, "base price"},
+		{"negative price", `[{"symbol": "A", "base_price": -1}]`, "base price"},
+		{"decimals", `[{"symbol": "A", "base_price": 10, "decimals": 19}]`, "decimals"},
+		{"negative decimals", `[{"symbol": "A", "base_price": 10, "decimals": -1}]`, "decimals"},
+		{"spread", `[{"symbol": "A", "base_price": 10, "spread_bps": -5}]`, "spread"},
+		{"trade size", `[{"symbol": "A", "base_price": 10, "trade_size": -5}]`, "trade size"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "symbols.json")
+			if err := os.WriteFile(path, []byte(tc.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadSymbols(path)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("loadSymbols(%s) = %v, want error containing %q", tc.config, err, tc.want)
+			}
+			if !strings.HasPrefix(err.Error(), path) {
+				t.Errorf("error %q doesn't name the file", err)
+			}
+		})
+	}
+}
+
+func TestLoadSymbolsAcceptsValidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "symbols.json")
+	config := `[{"symbol": "A", "base_price": 10, "decimals": 2, "spread_bps": 5, "trade_size": 1000},
+		{"symbol": "B", "base_price": 0.5, "decimals": 4}]`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	symbols, err := loadSymbols(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(symbols) != 2 || symbols[1].Symbol != "B" {
+		t.Errorf("got %+v", symbols)
+	}
+}
+
+// simulate runs a seeded market on a simulated clock for n ticks and
+// returns everything it published, encoded as clients would see it.
+func simulate(t *testing.T, seed int64, n int) []byte {
+	t.Helper()
+	load := loadProfile{Kind: bursty, Rate: 1000, BurstFactor: 10, BurstEvery: time.Second, BurstLength: 100 * time.Millisecond}
+	m := newMarket(defaultSymbols, 0, 0.8, seed, simEpoch)
+	clock := &simClock{t: simEpoch}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for range n {
+		ev := m.next(clock.advance(load))
+		for _, v := range []any{ev.trade, ev.ticker} {
+			if err := enc.Encode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if ev.hasBook {
+			enc.Encode(ev.book)
+		}
+	}
+	enc.Encode(m.bookSnapshots("*"))
+	return buf.Bytes()
+}
+
+func TestSeededMarketIsReproducible(t *testing.T) {
+	first, second := simulate(t, 42, 2000), simulate(t, 42, 2000)
+	if !bytes.Equal(first, second) {
+		i := 0
+		for i < min(len(first), len(second)) && first[i] == second[i] {
+			i++
+		}
+		t.Fatalf("runs with the same seed differ at byte %d:\n%.200s\n%.200s", i, first[i:], second[i:])
+	}
+	if other := simulate(t, 43, 2000); bytes.Equal(first, other) {
+		t.Error("runs with different seeds are identical")
+	}
+}
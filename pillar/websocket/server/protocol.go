@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Clients choose what they receive by sending requests modelled on
+// exchange feeds:
+//
+//	{"id": 1, "method": "subscribe", "params": ["BTCUSDT@ticker", "*@ticker"]}
+//	{"id": 2, "method": "unsubscribe", "params": ["BTCUSDT@ticker"]}
+//	{"id": 3, "method": "list_subscriptions"}
+//
+// Every request is answered with {"id": 1, "result": ...} or
+// {"id": 1, "error": {"code": ..., "msg": ...}}. Market data arrives as
+// {"stream": "BTCUSDT@ticker", "data": {...}}. A stream is SYMBOL@channel,
+// and the symbol "*" matches every symbol. The channels are "ticker" for
+// TickerData, "trade" for TradeData and "book" for BookData.
+type request struct {
+	Id     int64    `json:"id"`
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+}
+
+type response struct {
+	Id     int64          `json:"id"`
+	Result any            `json:"result"`
+	Error  *protocolError `json:"error,omitempty"`
+}
+
+type protocolError struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+const (
+	errCodeBadRequest    = 1
+	errCodeUnknownMethod = 2
+	errCodeBadStream     = 3
+)
+
+type streamMessage struct {
+	Stream string `json:"stream"`
+	Data   any    `json:"data"`
+}
+
+const (
+	channelTicker = "ticker"
+	channelTrade  = "trade"
+	channelBook   = "book"
+)
+
+// channels are the data channels a client can subscribe to.
+var channels = map[string]bool{
+	channelTicker: true,
+	channelTrade:  true,
+	channelBook:   true,
+}
+
+func streamName(symbol, channel string) string {
+	return symbol + "@" + channel
+}
+
+// subscriptions is the set of streams one client has asked for. It is
+// written by the connection's reader and read by whoever sends it data.
+type subscriptions struct {
+	mu      sync.RWMutex
+	streams map[string]bool
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{streams: make(map[string]bool)}
+}
+
+func (s *subscriptions) has(symbol, channel string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.streams[streamName(symbol, channel)] || s.streams[streamName("*", channel)]
+}
+
+func (s *subscriptions) list() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	streams := make([]string, 0, len(s.streams))
+	for stream := range s.streams {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+	return streams
+}
+
+// handle applies one client request and returns the reply to send back.
+func (s *subscriptions) handle(req request, isSymbol func(string) bool) response {
+	switch strings.ToLower(req.Method) {
+	case "subscribe", "unsubscribe":
+		if len(req.Params) == 0 {
+			return errorResponse(req.Id, errCodeBadRequest, "params must list at least one stream")
+		}
+		for _, stream := range req.Params {
+			if err := validStream(stream, isSymbol); err != nil {
+				return errorResponse(req.Id, errCodeBadStream, err.Error())
+			}
+		}
+		s.mu.Lock()
+		for _, stream := range req.Params {
+			if strings.EqualFold(req.Method, "subscribe") {
+				s.streams[stream] = true
+			} else {
+				delete(s.streams, stream)
+			}
+		}
+		s.mu.Unlock()
+		return response{Id: req.Id}
+	case "list_subscriptions":
+		return response{Id: req.Id, Result: s.list()}
+	}
+	return errorResponse(req.Id, errCodeUnknownMethod, fmt.Sprintf("unknown method %q", req.Method))
+}
+
+func validStream(stream string, isSymbol func(string) bool) error {
+	symbol, channel, ok := strings.Cut(stream, "@")
+	if !ok {
+		return fmt.Errorf("stream %q must be SYMBOL@channel", stream)
+	}
+	if !channels[channel] {
+		return fmt.Errorf("unknown channel %q", channel)
+	}
+	if symbol != "*" && !isSymbol(symbol) {
+		return fmt.Errorf("unknown symbol %q", symbol)
+	}
+	return nil
+}
+
+func errorResponse(id int64, code int, msg string) response {
+	return response{Id: id, Error: &protocolError{Code: code, Msg: msg}}
+}
+
+// maxRequestSize caps a client frame. Requests are short JSON objects,
+// so anything bigger is refused rather than buffered.
+const maxRequestSize = 4 << 10
+
+// readRequests handles client requests until the connection fails,
+// passing each reply to send and the streams of each successful
+// subscription to subscribed. It closes done when it returns. A frame
+// over maxRequestSize closes the connection with 1009.
+func readRequests(ws *websocket.Conn, subs *subscriptions, isSymbol func(string) bool, send func(response), subscribed func([]string), done chan<- struct{}) {
+	defer close(done)
+	ws.SetReadLimit(maxRequestSize)
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req request
+		if err := json.Unmarshal(message, &req); err != nil {
+			send(errorResponse(0, errCodeBadRequest, "malformed request: "+err.Error()))
+			continue
+		}
+		reply := subs.handle(req, isSymbol)
+		send(reply)
+		if reply.Error == nil && strings.EqualFold(req.Method, "subscribe") {
+			subscribed(req.Params)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// replayer plays back a recorded NDJSON feed of TickerData, one message per
+// line, in place of the simulated market.
+type replayer struct {
+	path    string
+	speed   float64 // 1 is original speed, 0 as fast as possible
+	loop    bool
+	symbols map[string]bool
+}
+
+// newReplayer checks the recording and collects its symbols, so clients
+// can subscribe before replay reaches them.
+func newReplayer(path string, speed float64, loop bool) (*replayer, error) {
+	if speed < 0 {
+		return nil, fmt.Errorf("replay speed must not be negative, got %v", speed)
+	}
+	r := &replayer{path: path, speed: speed, loop: loop, symbols: make(map[string]bool)}
+	err := r.scan(func(tick TickerData) {
+		r.symbols[tick.Symbol] = true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(r.symbols) == 0 {
+		return nil, fmt.Errorf("%s: no ticks recorded", path)
+	}
+	return r, nil
+}
+
+func (r *replayer) hasSymbol(symbol string) bool {
+	return r.symbols[symbol]
+}
+
+// run replays the recording through publish, pacing messages by their
+// event times. Late ticks, whose event time is behind one already sent,
+// go out straight away just as they arrived when recorded.
+func (r *replayer) run(publish func(TickerData)) error {
+	for {
+		var start time.Time
+		var first, latest int64
+		err := r.scan(func(tick TickerData) {
+			if start.IsZero() {
+				start, first, latest = time.Now(), tick.EventTime, tick.EventTime
+			}
+			if r.speed > 0 && tick.EventTime > latest {
+				latest = tick.EventTime
+				offset := time.Duration(float64(latest-first) * float64(time.Millisecond) / r.speed)
+				time.Sleep(time.Until(start.Add(offset)))
+			}
+			publish(tick)
+		})
+		if err != nil || !r.loop {
+			return err
+		}
+	}
+}
+
+// scan reads every tick in the recording.
+func (r *replayer) scan(fn func(TickerData)) error {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var tick TickerData
+		if err := json.Unmarshal(sc.Bytes(), &tick); err != nil {
+			return fmt.Errorf("%s:%d: %w", r.path, line, err)
+		}
+		fn(tick)
+	}
+	return sc.Err()
+}
+
+// recorder writes every published tick to an NDJSON file that replay
+// can read back.
+type recorder struct {
+	enc *json.Encoder
+}
+
+func newRecorder(w io.Writer) *recorder {
+	return &recorder{enc: json.NewEncoder(w)}
+}
+
+func (r *recorder) record(tick TickerData) error {
+	return r.enc.Encode(tick)
+}
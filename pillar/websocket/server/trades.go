@@ -0,0 +1,40 @@
+package main
+
+import (
+	"time"
+
+	"github.com/rasha-hantash/interviews/pillar/decimal"
+)
+
+// TradeData is a message on a SYMBOL@trade stream: one execution. Trade
+// ids run from the ticker's FirstId to its LastId without gaps, and the
+// ticker's Volume and QuoteVolume are the running sums of Qty and
+// Price*Qty over those trades, in id order. Each trade is published
+// before the ticker that includes it.
+type TradeData struct {
+	EventTime int64           `json:"event_time"`
+	Symbol    string          `json:"symbol"`
+	TradeId   int64           `json:"trade_id"`
+	Price     decimal.Decimal `json:"price"`
+	Qty       float64         `json:"qty"`
+	Side      string          `json:"side"` // aggressor: "buy" lifts the ask, "sell" hits the bid
+	TradeTime int64           `json:"trade_time"`
+}
+
+const (
+	sideBuy  = "buy"
+	sideSell = "sell"
+)
+
+// lastTrade returns the trade made by the latest call to trade.
+func (s *symbolState) lastTrade(now time.Time) TradeData {
+	return TradeData{
+		EventTime: now.UnixMilli(),
+		Symbol:    s.cfg.Symbol,
+		TradeId:   s.lastId,
+		Price:     s.price,
+		Qty:       s.lastQty,
+		Side:      s.lastSide,
+		TradeTime: now.UnixMilli(),
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// Trades must account exactly for the tickers published with them: ids
+// without gaps from FirstId to LastId, and Volume and QuoteVolume as the
+// running sums over those trades.
+func TestTradesMatchTicker(t *testing.T) {
+	m := newMarket(defaultSymbols, 0, 0.8, 11, simEpoch)
+	clock := &simClock{t: simEpoch}
+	load := loadProfile{Kind: steady, Rate: 100}
+
+	type totals struct {
+		nextId           int64
+		volume, quoteVol float64
+		trades           int64
+	}
+	seen := make(map[string]*totals)
+	for range 5000 {
+		ev := m.next(clock.advance(load))
+		tr, tk := ev.trade, ev.ticker
+		if tr.Symbol != tk.Symbol {
+			t.Fatalf("trade for %s published with the ticker for %s", tr.Symbol, tk.Symbol)
+		}
+		sum, ok := seen[tr.Symbol]
+		if !ok {
+			sum = &totals{nextId: tk.FirstId}
+			seen[tr.Symbol] = sum
+		}
+		if tr.TradeId != sum.nextId {
+			t.Fatalf("%s: trade id %d, want %d", tr.Symbol, tr.TradeId, sum.nextId)
+		}
+		sum.nextId++
+		sum.trades++
+		sum.volume += tr.Qty
+		sum.quoteVol += tr.Qty * tr.Price.Float64()
+
+		if tk.LastId != tr.TradeId || tk.Count != sum.trades || tk.LastId-tk.FirstId+1 != tk.Count {
+			t.Fatalf("%s: ticker ids %d..%d count %d after trade %d (trade %d)",
+				tr.Symbol, tk.FirstId, tk.LastId, tk.Count, tr.TradeId, sum.trades)
+		}
+		if !tk.Price.Equal(tr.Price) || tk.LastQty != tr.Qty {
+			t.Fatalf("%s: ticker last %s x %v, trade %s x %v", tr.Symbol, tk.Price, tk.LastQty, tr.Price, tr.Qty)
+		}
+		if !closeTo(tk.Volume, sum.volume) || !closeTo(tk.QuoteVolume, sum.quoteVol) {
+			t.Fatalf("%s: ticker volume %v / %v, trades sum to %v / %v",
+				tr.Symbol, tk.Volume, tk.QuoteVolume, sum.volume, sum.quoteVol)
+		}
+		switch {
+		case tr.Side == sideBuy && !tr.Price.Equal(tk.AskPrice),
+			tr.Side == sideSell && !tr.Price.Equal(tk.BidPrice),
+			tr.Side != sideBuy && tr.Side != sideSell:
+			t.Fatalf("%s: %s trade at %s against quote %s/%s", tr.Symbol, tr.Side, tr.Price, tk.BidPrice, tk.AskPrice)
+		}
+		if tr.Qty <= 0 || math.IsInf(tr.Qty, 0) {
+			t.Fatalf("%s: trade quantity %v", tr.Symbol, tr.Qty)
+		}
+	}
+	if len(seen) != len(defaultSymbols) {
+		t.Errorf("trades for %d symbols, want %d", len(seen), len(defaultSymbols))
+	}
+}
+
+// closeTo compares running float sums, which may differ in the last bits
+// depending on the order they were added in.
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(math.Abs(a), math.Abs(b))
+}